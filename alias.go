@@ -0,0 +1,79 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"fmt"
+	"sort"
+)
+
+// lookupValue returns the key providing the value of a property, the
+// unresolved value, and whether it came from the configuration store. The
+// key is the property's own key unless it has no value and a deprecated key
+// aliased to it does. The configuration store is not consulted for a
+// deprecated key when the property itself is locked.
+func (fc *flexibleConfiguration) lookupValue(k string) (string, string, bool) {
+	useStore := fc.useStore(k)
+	val, fromStore := fc.storedValue(k, useStore)
+	if len(val) > 0 {
+		return k, val, fromStore
+	}
+
+	for _, old := range fc.aliasesOf(k) {
+		oldVal, oldFromStore := fc.storedValue(old,
+			useStore && fc.useStore(old))
+		if len(oldVal) > 0 {
+			return old, oldVal, oldFromStore
+		}
+	}
+
+	return k, val, fromStore
+}
+
+// aliasesOf returns the deprecated keys aliased to a key, in order.
+func (fc *flexibleConfiguration) aliasesOf(k string) []string {
+	var aliases []string
+	for old, replacement := range fc.aliases {
+		if replacement == k {
+			aliases = append(aliases, old)
+		}
+	}
+
+	sort.Strings(aliases)
+
+	return aliases
+}
+
+// warnDeprecated reports, the first time it is used, that the value of a
+// deprecated key is being used in place of the key replacing it.
+func (fc *flexibleConfiguration) warnDeprecated(old, k string) {
+	fc.aliasLock.Lock()
+	warned := fc.aliasWarned[old]
+	if !warned {
+		if fc.aliasWarned == nil {
+			fc.aliasWarned = make(map[string]bool)
+		}
+
+		fc.aliasWarned[old] = true
+	}
+	fc.aliasLock.Unlock()
+
+	if !warned && fc.warn != nil {
+		fc.warn(fmt.Sprintf("Property %s from %s is deprecated, use %s",
+			old, fc.sourceOf(old), k))
+	}
+}
@@ -0,0 +1,96 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_alias_fallback(t *testing.T) {
+	os.Args = []string{"test", "--old.timeout=30", "--old.host=oldHost",
+		"--new.host=newHost"}
+	defer func() { os.Args = []string{} }()
+
+	// Tests in config_test.go expect to run before a global configuration
+	// has been created.
+	defer func() { configuration = nil }()
+
+	store := newMemStore("")
+	var warnings []string
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		KeyAliases: map[string]string{
+			"old.timeout": "new.timeout",
+			"old.host":    "new.host",
+			"old.stored":  "new.stored",
+		},
+		KnownKeys:          []string{"new.*"},
+		ConfigurationStore: store,
+		WarningHandler: func(warning string) {
+			warnings = append(warnings, warning)
+		},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if len(warnings) != 0 {
+		t.Errorf("Expected aliased keys to be known, found %v", warnings)
+	}
+
+	if cfg.Get("new.timeout") != "30" || !cfg.Exists("new.timeout") {
+		t.Errorf("Expected value of old key, found '%s'",
+			cfg.Get("new.timeout"))
+	}
+
+	cfg.Get("new.timeout")
+	if len(warnings) != 1 || warnings[0] != "Property old.timeout from "+
+		"command line argument 1 is deprecated, use new.timeout" {
+		t.Errorf("Expected one deprecation warning, found %v", warnings)
+	}
+
+	if cfg.Get("new.host") != "newHost" {
+		t.Errorf("Expected new key to win, found '%s'", cfg.Get("new.host"))
+	}
+
+	chain := cfg.(ExtendedConfig).Explain("new.timeout")
+	if len(chain) != 1 || chain[0].Argument != 1 {
+		t.Errorf("Expected provenance of old key, found %v", chain)
+	}
+
+	// Aliases apply to the configuration store
+	store.Set("old.stored", "fromStore")
+	if cfg.Get("new.stored") != "fromStore" {
+		t.Errorf("Expected old key from store, found '%s'",
+			cfg.Get("new.stored"))
+	}
+
+	cfg.Set("new.stored", "replacement")
+	if cfg.Get("new.stored") != "replacement" {
+		t.Errorf("Expected new key to win over store, found '%s'",
+			cfg.Get("new.stored"))
+	}
+
+	var b bytes.Buffer
+	cfg.(ExtendedConfig).Export(&b, ConfigurationFormatProperties, false)
+	if !strings.Contains(b.String(), "new.timeout=30\n") {
+		t.Errorf("Expected new key in export: %s", b.String())
+	}
+}
@@ -93,3 +93,25 @@ func conformsToKey(arg string) bool {
 
 	return true
 }
+
+// commandLineArgIndex returns the index of the argument from which
+// readCommandLineArgs would set the specified property, or 0 if there is
+// none.
+func commandLineArgIndex(args []string, key string) int {
+	index := 0
+	for i, arg := range args {
+		if i == 0 {
+			continue
+		}
+
+		if arg == "--" {
+			break
+		}
+
+		if strings.HasPrefix(arg, "--"+key+"=") {
+			index = i
+		}
+	}
+
+	return index
+}
@@ -0,0 +1,278 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditOperationSet     = "set"
+	auditOperationDelete  = "delete"
+	auditOperationLoad    = "load"
+	auditOperationRestore = "restore"
+)
+
+// AuditEvent records a change, or an attempted change, to a property.
+// Operation is "set", "delete", "load", or "restore". Layer is where the
+// change was made: "Set", "Load", or "Restore" for the memory store of a
+// Config, or "configuration store". The values of sensitive properties are
+// replaced by RedactedValue. Error describes why an attempted change was not
+// made, and is empty when the change succeeded.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Key       string    `json:"key"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	Identity  string    `json:"identity"`
+	Layer     string    `json:"layer"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// AuditSink receives the AuditEvents describing changes to a configuration.
+type AuditSink interface {
+	// Audit records the event.
+	Audit(event AuditEvent) error
+}
+
+// FileAuditSink is an AuditSink appending each event to a file as a line of
+// JSON.
+type FileAuditSink struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink returns an AuditSink appending events to the file, which
+// is created with permissions allowing only its owner to read it if it does
+// not exist.
+func NewFileAuditSink(filename string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE,
+		0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditSink{file: f}, nil
+}
+
+// Audit appends the event to the file.
+func (fas *FileAuditSink) Audit(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	fas.lock.Lock()
+	defer fas.lock.Unlock()
+
+	_, err = fas.file.Write(append(line, '\n'))
+
+	return err
+}
+
+// Close closes the file.
+func (fas *FileAuditSink) Close() error {
+	fas.lock.Lock()
+	defer fas.lock.Unlock()
+
+	return fas.file.Close()
+}
+
+// defaultAuditIdentity returns the name of the user running the process,
+// or its user ID if the name is not available.
+func defaultAuditIdentity() string {
+	u, err := user.Current()
+	if err == nil && len(u.Username) > 0 {
+		return u.Username
+	}
+
+	return strconv.Itoa(os.Getuid())
+}
+
+// newAuditEvent returns an event for a change to a property.
+func newAuditEvent(
+	operation, key, oldValue, newValue, identity, layer string,
+	err error) AuditEvent {
+	event := AuditEvent{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Key:       key,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		Identity:  identity,
+		Layer:     layer,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	return event
+}
+
+// audit sends an event for a change to the memory store to the audit sink,
+// if there is one. Values are redacted if the property is sensitive. A
+// failure to record the event is reported as a warning.
+func (fc *flexibleConfiguration) audit(
+	operation, key, oldValue, newValue, layer string,
+	err error) {
+	if fc.auditSink == nil {
+		return
+	}
+
+	event := newAuditEvent(operation, key, fc.redact(key, oldValue),
+		fc.redact(key, newValue), fc.auditIdentity, layer, err)
+
+	auditErr := fc.auditSink.Audit(event)
+	if auditErr != nil && fc.warn != nil {
+		fc.warn(fmt.Sprintf("Unable to record audit event for %s: %v",
+			key, auditErr))
+	}
+}
+
+// auditedStruct is a FlexConfigStore recording changes made through it.
+type auditedStruct struct {
+	store         FlexConfigStore
+	sink          AuditSink
+	identity      string
+	sensitiveKeys []string
+}
+
+// NewAuditedFlexConfigStore returns a FlexConfigStore sending an AuditEvent
+// to the sink for every Set and Delete made through it, including those that
+// fail. The identity is recorded as the author of each change; if empty, the
+// name of the user running the process is used. The values of properties
+// matching sensitiveKeys, which may be patterns in the same way as
+// SensitiveKeys in the ConfigurationParameters, are redacted. If the event
+// cannot be recorded, the error from the sink is returned after the change
+// is made.
+func NewAuditedFlexConfigStore(
+	store FlexConfigStore,
+	sink AuditSink,
+	identity string,
+	sensitiveKeys []string) FlexConfigStore {
+	if len(identity) == 0 {
+		identity = defaultAuditIdentity()
+	}
+
+	as := new(auditedStruct)
+	as.store = store
+	as.sink = sink
+	as.identity = identity
+	as.sensitiveKeys = sensitiveKeys
+
+	return as
+}
+
+// Get returns a property value from the underlying store.
+func (as *auditedStruct) Get(key string) (string, error) {
+	return as.store.Get(key)
+}
+
+// GetAll returns all properties in the underlying store.
+func (as *auditedStruct) GetAll() ([]KeyValue, error) {
+	return as.store.GetAll()
+}
+
+// Set writes the property to the underlying store and records the change.
+func (as *auditedStruct) Set(key, val string) error {
+	old, _ := as.store.Get(key)
+	err := as.store.Set(key, val)
+
+	return as.record(auditOperationSet, key, old, val, err)
+}
+
+// Delete removes the property from the underlying store and records the
+// change.
+func (as *auditedStruct) Delete(key string) error {
+	old, _ := as.store.Get(key)
+	err := as.store.Delete(key)
+
+	return as.record(auditOperationDelete, key, old, "", err)
+}
+
+// ApplyBatch applies the batch to the underlying store and records each
+// change it sets or deletes. The batch is applied atomically only if the
+// underlying store implements FlexConfigStoreBatcher; otherwise each change
+// is made, and recorded, by Set or Delete. If the batch fails, each change is
+// recorded with the error.
+func (as *auditedStruct) ApplyBatch(expected, desired map[string]string) error {
+	batcher, ok := as.store.(FlexConfigStoreBatcher)
+	if !ok {
+		return applyChanges(as, expected, desired)
+	}
+
+	keys := sortedKeys(desired)
+	old := make(map[string]string)
+	for _, k := range keys {
+		old[k], _ = as.store.Get(k)
+	}
+
+	err := batcher.ApplyBatch(expected, desired)
+
+	var auditErr error
+	for _, k := range keys {
+		operation := auditOperationSet
+		if len(desired[k]) == 0 {
+			operation = auditOperationDelete
+		}
+
+		recordErr := as.record(operation, k, old[k], desired[k], err)
+		if auditErr == nil {
+			auditErr = recordErr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return auditErr
+}
+
+// GetPrefix returns the prefix of the underlying store.
+func (as *auditedStruct) GetPrefix() string {
+	return as.store.GetPrefix()
+}
+
+// record sends the event for a change to the sink, returning the error from
+// the change, or else the error from the sink.
+func (as *auditedStruct) record(
+	operation, key, oldValue, newValue string,
+	err error) error {
+	k := strings.TrimSpace(key)
+	if matchesKeyPattern(as.sensitiveKeys, k) {
+		oldValue = redactValue(oldValue)
+		newValue = redactValue(newValue)
+	}
+
+	auditErr := as.sink.Audit(newAuditEvent(operation, k, oldValue,
+		newValue, as.identity, sourceStore, err))
+	if err != nil {
+		return err
+	}
+
+	return auditErr
+}
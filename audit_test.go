@@ -0,0 +1,185 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// memAuditSink is an AuditSink keeping events in memory.
+type memAuditSink struct {
+	events []AuditEvent
+	err    error
+}
+
+func (mas *memAuditSink) Audit(event AuditEvent) error {
+	mas.events = append(mas.events, event)
+	return mas.err
+}
+
+func Test_audit_config(t *testing.T) {
+	os.Args = []string{}
+
+	// Tests in config_test.go expect to run before a global configuration
+	// has been created.
+	defer func() { configuration = nil }()
+
+	sink := new(memAuditSink)
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		SensitiveKeys: []string{"*.password"},
+		LockedKeys:    []string{"locked.key"},
+		AuditSink:     sink,
+		AuditIdentity: "deployer",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("app.level", "1")
+	cfg.Set("app.level", "2")
+	cfg.Set("db.password", "s3cret")
+	cfg.Set("locked.key", "x")
+	cfg.(ExtendedConfig).Load(strings.NewReader("app.level: 3\n"),
+		ConfigurationFormatYAML)
+
+	expected := []AuditEvent{
+		{Operation: "set", Key: "app.level", OldValue: "", NewValue: "1",
+			Layer: sourceSet},
+		{Operation: "set", Key: "app.level", OldValue: "1", NewValue: "2",
+			Layer: sourceSet},
+		{Operation: "set", Key: "db.password", OldValue: "",
+			NewValue: RedactedValue, Layer: sourceSet},
+		{Operation: "set", Key: "locked.key", NewValue: "x",
+			Layer: sourceSet, Error: "Property is locked: locked.key"},
+		{Operation: "load", Key: "app.level", OldValue: "2", NewValue: "3",
+			Layer: sourceLoad},
+	}
+
+	if len(sink.events) != len(expected) {
+		t.Errorf("Expected %d events, found %v", len(expected), sink.events)
+		return
+	}
+
+	for i, e := range expected {
+		event := sink.events[i]
+		if event.Time.IsZero() || event.Identity != "deployer" {
+			t.Errorf("Event %d: missing time or identity: %+v", i, event)
+		}
+
+		event.Time = e.Time
+		event.Identity = ""
+		if event != e {
+			t.Errorf("Event %d: expected %+v, found %+v", i, e, event)
+		}
+	}
+}
+
+func Test_audit_fileSink(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigAudit")
+	if err != nil {
+		t.Errorf("Can't create temporary file")
+		return
+	}
+
+	f.Close()
+	defer os.Remove(f.Name())
+
+	sink, err := NewFileAuditSink(f.Name())
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	sink.Audit(newAuditEvent("set", "a.b", "", "1", "ops", sourceSet, nil))
+	sink.Audit(newAuditEvent("delete", "a.b", "1", "", "ops", sourceStore,
+		errors.New("denied")))
+	sink.Close()
+
+	contents, _ := ioutil.ReadFile(f.Name())
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) != 2 {
+		t.Errorf("Expected 2 lines, found %d", len(lines))
+		return
+	}
+
+	var event AuditEvent
+	err = json.Unmarshal([]byte(lines[1]), &event)
+	if err != nil || event.Operation != "delete" || event.Key != "a.b" ||
+		event.OldValue != "1" || event.Error != "denied" ||
+		event.Identity != "ops" || event.Layer != sourceStore {
+		t.Errorf("Unexpected event: %+v (%v)", event, err)
+	}
+
+	if !strings.Contains(lines[0], `"new_value":"1"`) ||
+		strings.Contains(lines[0], `"error"`) {
+		t.Errorf("Unexpected JSON: %s", lines[0])
+	}
+}
+
+func Test_audit_store(t *testing.T) {
+	backing := newMemStore("")
+	sink := new(memAuditSink)
+	store := NewAuditedFlexConfigStore(backing, sink, "ops",
+		[]string{"*.token"})
+
+	store.Set("a.b", "1")
+	store.Set("api.token", "abc")
+	store.Delete("a.b")
+
+	expected := []AuditEvent{
+		{Operation: "set", Key: "a.b", NewValue: "1"},
+		{Operation: "set", Key: "api.token", NewValue: RedactedValue},
+		{Operation: "delete", Key: "a.b", OldValue: "1"},
+	}
+
+	if len(sink.events) != len(expected) {
+		t.Errorf("Expected %d events, found %v", len(expected), sink.events)
+		return
+	}
+
+	for i, e := range expected {
+		event := sink.events[i]
+		if event.Operation != e.Operation || event.Key != e.Key ||
+			event.OldValue != e.OldValue || event.NewValue != e.NewValue ||
+			event.Identity != "ops" || event.Layer != sourceStore {
+			t.Errorf("Event %d: expected %+v, found %+v", i, e, event)
+		}
+	}
+
+	// A failure to record the event is returned after the change is made
+	sink.err = errors.New("disk full")
+	err := store.Set("c.d", "2")
+	if err != sink.err || backing.kvs["c.d"] != "2" {
+		t.Errorf("Expected sink error after change, found %v", err)
+	}
+
+	// A failed change is recorded with its error
+	denied := NewAuditedFlexConfigStore(
+		NewPolicyFlexConfigStore(backing, "ops", nil), sink, "ops", nil)
+	sink.err = nil
+	err = denied.Set("e.f", "3")
+	last := sink.events[len(sink.events)-1]
+	if !errors.Is(err, ErrWriteDenied) || len(last.Error) == 0 {
+		t.Errorf("Expected denied write to be recorded, found %+v", last)
+	}
+}
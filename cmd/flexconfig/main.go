@@ -0,0 +1,425 @@
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Command flexconfig reads and writes the properties in a flexconfig
+configuration store using the same property keys as an application, so that
+log.filepath in a store with the prefix /example is read and written without
+translating it by hand to the etcd key /example/log/filepath.
+
+Usage:
+
+	flexconfig [flags] get <key>
+	flexconfig [flags] set <key> <value>
+	flexconfig [flags] delete <key>
+	flexconfig [flags] list [-prefix <key>] [-sensitive <keys>]
+	flexconfig [flags] watch [-sensitive <keys>] [<key>]
+	flexconfig [flags] import [-format <format>] [-dry-run] [-sensitive <keys>] <file>
+	flexconfig [flags] export [-format <format>] [-dry-run] [-sensitive <keys>] <file>
+	flexconfig [flags] plan [-prune] [-sensitive <keys>] <file or directory>
+	flexconfig [flags] apply [-prune] [-sensitive <keys>] <file or directory>
+
+The flags are:
+
+	-endpoints
+		Comma separated etcd endpoints. Defaults to the value of the
+		FLEXCONFIG_ENDPOINTS or ETCDCTL_ENDPOINTS environment variable.
+	-prefix
+		Prefix of the configuration store. Defaults to the value of the
+		FLEXCONFIG_PREFIX environment variable.
+	-user
+		User to authenticate to etcd as. Defaults to the value of the
+		FLEXCONFIG_USER environment variable. The password is read from
+		the FLEXCONFIG_PASSWORD environment variable.
+
+Delete removes the property with the key and the properties below it, so
+that deleting log removes log.filepath but not logger.name.
+
+List prints the properties with the key given by -prefix, or below it, in
+order of key as key=value lines. Watch prints a line for every change to the
+property with the key, or below it, until interrupted: key=value when a
+property is set, and "deleted key" when it is deleted. Without a key, every
+property in the store is listed or watched. Watch exits with status 1 if
+the store stops reporting changes before it is interrupted. Both print
+******** in place of the values of properties matching the comma
+separated keys or patterns given by -sensitive. Get prints the value of the
+property it is given as it is, as the value is what was asked for.
+
+Import writes the properties in a YAML, JSON, or INI file into the store,
+leaving other properties in the store unchanged, and export replaces the
+contents of the file with every property in the store. The format is implied
+by the name of the file unless given by -format as yaml, json, or ini. Both
+print the changes they make, as described for flexconfig.WriteDiff, and with
+-dry-run print the changes without making them. The values of properties
+matching the comma separated keys or patterns given by -sensitive are not
+printed.
+
+Plan prints the changes that make the store match the desired state defined
+by a YAML, JSON, or INI file, or by every such file in a directory, including
+files with the suffix .conf in any of these formats, and apply
+prints and makes them in a single etcd transaction, which fails without
+changing the store if a property being changed was changed after the plan
+was made. etcd limits the number of operations in a transaction, 128 unless
+the server is started with a different --max-txn-ops, and a plan with more
+changes than that fails without changing the store. With -prune, properties
+the desired state does not define are deleted.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/zadoo/flexconfig"
+)
+
+const (
+	endpointsEnvironmentVariable     = "FLEXCONFIG_ENDPOINTS"
+	etcdEndpointsEnvironmentVariable = "ETCDCTL_ENDPOINTS"
+	prefixEnvironmentVariable        = "FLEXCONFIG_PREFIX"
+	userEnvironmentVariable          = "FLEXCONFIG_USER"
+	passwordEnvironmentVariable      = "FLEXCONFIG_PASSWORD"
+)
+
+var (
+	errUsage         = errors.New("Usage error")
+	errNotFound      = errors.New("Property not found")
+	errWatchNotValid = errors.New("Store does not support watch")
+)
+
+// storeOpener creates the configuration store the command operates on.
+type storeOpener func(
+	endpoints []string,
+	prefix string,
+	credentials flexconfig.StoreCredentials) (flexconfig.FlexConfigStore, error)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr,
+		openEtcdStore))
+}
+
+// openEtcdStore creates an etcd configuration store.
+func openEtcdStore(
+	endpoints []string,
+	prefix string,
+	credentials flexconfig.StoreCredentials) (flexconfig.FlexConfigStore, error) {
+	return flexconfig.NewAuthenticatedFlexConfigStore(
+		flexconfig.FlexConfigStoreEtcd, endpoints, prefix, credentials)
+}
+
+// run executes the command line and returns the exit status: 0 on success,
+// 1 if the command failed, and 2 if the command line is not valid.
+func run(
+	ctx context.Context,
+	args []string,
+	getenv func(string) string,
+	stdout, stderr io.Writer,
+	open storeOpener) int {
+	endpoints := getenv(endpointsEnvironmentVariable)
+	if len(endpoints) == 0 {
+		endpoints = getenv(etcdEndpointsEnvironmentVariable)
+	}
+
+	flags := flag.NewFlagSet("flexconfig", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&endpoints, "endpoints", endpoints,
+		"comma separated etcd endpoints")
+	prefix := flags.String("prefix", getenv(prefixEnvironmentVariable),
+		"prefix of the configuration store")
+	user := flags.String("user", getenv(userEnvironmentVariable),
+		"user to authenticate to etcd as")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: flexconfig [flags] "+
+			"get|set|delete|list|watch|import|export|plan|apply [args]")
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	store, err := open(splitList(endpoints), *prefix,
+		flexconfig.StoreCredentials{
+			Username: *user,
+			Password: getenv(passwordEnvironmentVariable),
+		})
+	if err != nil {
+		fmt.Fprintln(stderr, "flexconfig:", err)
+		return 1
+	}
+
+	err = runCommand(ctx, store, flags.Arg(0), flags.Args()[1:], stdout,
+		stderr)
+	if errors.Is(err, errUsage) {
+		flags.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, "flexconfig:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// runCommand executes a subcommand against the store.
+func runCommand(
+	ctx context.Context,
+	store flexconfig.FlexConfigStore,
+	command string,
+	args []string,
+	stdout, stderr io.Writer) error {
+	switch command {
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		val, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+
+		if len(val) == 0 {
+			return fmt.Errorf("%w: %s", errNotFound, args[0])
+		}
+
+		fmt.Fprintln(stdout, val)
+	case "set":
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		return store.Set(args[0], args[1])
+	case "delete":
+		if len(args) != 1 {
+			return errUsage
+		}
+
+		return store.Delete(args[0])
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		prefix := flags.String("prefix", "", "list properties below this key")
+		sensitive := flags.String("sensitive", "",
+			"comma separated keys whose values are not printed")
+		if flags.Parse(args) != nil || flags.NArg() != 0 {
+			return errUsage
+		}
+
+		return list(store, strings.TrimSpace(*prefix), splitList(*sensitive),
+			stdout)
+	case "watch":
+		flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		sensitive := flags.String("sensitive", "",
+			"comma separated keys whose values are not printed")
+		if flags.Parse(args) != nil || flags.NArg() > 1 {
+			return errUsage
+		}
+
+		return watch(ctx, store, flags.Arg(0), splitList(*sensitive), stdout)
+	case "import", "export":
+		return transfer(store, command, args, stdout, stderr)
+	case "plan", "apply":
+		return reconcile(store, command, args, stdout, stderr)
+	default:
+		return errUsage
+	}
+
+	return nil
+}
+
+// list writes the properties with the key, or below it, in order of key,
+// redacting the values of sensitive properties.
+func list(
+	store flexconfig.FlexConfigStore,
+	key string,
+	sensitiveKeys []string,
+	w io.Writer) error {
+	kvs, err := store.GetAll()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+
+	for _, kv := range kvs {
+		if below(kv.Key, key) {
+			fmt.Fprintf(w, "%s=%s\n", kv.Key,
+				flexconfig.RedactValue(sensitiveKeys, kv.Key, kv.Value))
+		}
+	}
+
+	return nil
+}
+
+// watch writes each change to the property with the key, or below it, until
+// the context is done, redacting the values of sensitive properties. An error
+// ending the watch before then is returned.
+func watch(
+	ctx context.Context,
+	store flexconfig.FlexConfigStore,
+	key string,
+	sensitiveKeys []string,
+	w io.Writer) error {
+	watcher, ok := store.(flexconfig.FlexConfigStoreWatcher)
+	if !ok {
+		return errWatchNotValid
+	}
+
+	events, err := watcher.Watch(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for ev := range events {
+		if ev.Err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return ev.Err
+		}
+
+		if ev.Deleted {
+			fmt.Fprintf(w, "deleted %s\n", ev.Key)
+		} else {
+			fmt.Fprintf(w, "%s=%s\n", ev.Key,
+				flexconfig.RedactValue(sensitiveKeys, ev.Key, ev.Value))
+		}
+	}
+
+	return nil
+}
+
+// transfer imports a file into the store, or exports the store to a file,
+// and writes the changes made.
+func transfer(
+	store flexconfig.FlexConfigStore,
+	command string,
+	args []string,
+	stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", "format of the file: yaml, json, or ini")
+	dryRun := flags.Bool("dry-run", false, "print the changes without making them")
+	sensitive := flags.String("sensitive", "",
+		"comma separated keys whose values are not printed")
+	if flags.Parse(args) != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	opts := flexconfig.StoreFileOptions{
+		DryRun:        *dryRun,
+		SensitiveKeys: splitList(*sensitive),
+	}
+	switch *format {
+	case "":
+	case "yaml":
+		opts.Format = flexconfig.ConfigurationFormatYAML
+	case "json":
+		opts.Format = flexconfig.ConfigurationFormatJSON
+	case "ini":
+		opts.Format = flexconfig.ConfigurationFormatINI
+	default:
+		return errUsage
+	}
+
+	var changes []flexconfig.Change
+	var err error
+	if command == "import" {
+		changes, err = flexconfig.ImportStoreFile(store, flags.Arg(0), opts)
+	} else {
+		changes, err = flexconfig.ExportStoreFile(store, flags.Arg(0), opts)
+	}
+
+	flexconfig.WriteDiff(stdout, changes)
+
+	return err
+}
+
+// reconcile writes the plan to make the store match the desired state, and
+// applies it for the apply command.
+func reconcile(
+	store flexconfig.FlexConfigStore,
+	command string,
+	args []string,
+	stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	prune := flags.Bool("prune", false, "delete properties not in the desired state")
+	sensitive := flags.String("sensitive", "",
+		"comma separated keys whose values are not printed")
+	if flags.Parse(args) != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	plan, err := flexconfig.PlanStore(store, flags.Arg(0),
+		flexconfig.PlanOptions{
+			Prune:         *prune,
+			SensitiveKeys: splitList(*sensitive),
+		})
+	if err != nil {
+		return err
+	}
+
+	flexconfig.WriteDiff(stdout, plan.Changes)
+	if command == "plan" {
+		return nil
+	}
+
+	return plan.Apply()
+}
+
+// below returns whether the key is the parent key, or a key below it. Every
+// key is below an empty parent key.
+func below(key, parent string) bool {
+	return len(parent) == 0 || key == parent ||
+		strings.HasPrefix(key, parent+".")
+}
+
+// splitList returns the elements of a comma separated list.
+func splitList(list string) []string {
+	var result []string
+	for _, e := range strings.Split(list, ",") {
+		e = strings.TrimSpace(e)
+		if len(e) > 0 {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,295 @@
+package main
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zadoo/flexconfig"
+)
+
+// fakeStore is a FlexConfigStore keeping properties in memory, whose Watch
+// reports the events it was given.
+type fakeStore struct {
+	prefix string
+	kvs    map[string]string
+	events []flexconfig.WatchEvent
+}
+
+func (fs *fakeStore) Get(key string) (string, error) {
+	return fs.kvs[key], nil
+}
+
+func (fs *fakeStore) GetAll() ([]flexconfig.KeyValue, error) {
+	var result []flexconfig.KeyValue
+	for k, v := range fs.kvs {
+		result = append(result, flexconfig.KeyValue{Key: k, Value: v})
+	}
+
+	return result, nil
+}
+
+func (fs *fakeStore) Set(key, val string) error {
+	fs.kvs[key] = val
+	return nil
+}
+
+func (fs *fakeStore) Delete(key string) error {
+	for k := range fs.kvs {
+		if below(k, key) {
+			delete(fs.kvs, k)
+		}
+	}
+
+	return nil
+}
+
+func (fs *fakeStore) GetPrefix() string {
+	return fs.prefix
+}
+
+func (fs *fakeStore) Watch(
+	ctx context.Context,
+	key string) (<-chan flexconfig.WatchEvent, error) {
+	events := make(chan flexconfig.WatchEvent, len(fs.events))
+	for _, ev := range fs.events {
+		if ev.Err != nil || below(ev.Key, key) {
+			events <- ev
+		}
+	}
+
+	close(events)
+	return events, nil
+}
+
+// runWith runs the command line against the store, returning the exit
+// status and the output.
+func runWith(
+	store *fakeStore,
+	env map[string]string,
+	args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(context.Background(), args,
+		func(name string) string { return env[name] }, &stdout, &stderr,
+		func(endpoints []string, prefix string,
+			credentials flexconfig.StoreCredentials) (flexconfig.FlexConfigStore, error) {
+			store.prefix = prefix + "|" + strings.Join(endpoints, ",") +
+				"|" + credentials.Username + ":" + credentials.Password
+			return store, nil
+		})
+
+	return status, stdout.String(), stderr.String()
+}
+
+func Test_main_commands(t *testing.T) {
+	store := &fakeStore{kvs: map[string]string{}}
+
+	status, _, _ := runWith(store, nil, "set", "log.filepath", "/var/log/a")
+	if status != 0 || store.kvs["log.filepath"] != "/var/log/a" {
+		t.Errorf("Unexpected result of set: %d %v", status, store.kvs)
+	}
+
+	status, out, _ := runWith(store, nil, "get", "log.filepath")
+	if status != 0 || out != "/var/log/a\n" {
+		t.Errorf("Unexpected result of get: %d %q", status, out)
+	}
+
+	status, _, errOut := runWith(store, nil, "get", "log.level")
+	if status != 1 || !strings.Contains(errOut, "Property not found") {
+		t.Errorf("Unexpected result of get of missing property: %d %q",
+			status, errOut)
+	}
+
+	store.kvs["logger.name"] = "main"
+	store.kvs["log.level"] = "info"
+	status, out, _ = runWith(store, nil, "list", "--prefix", "log")
+	if status != 0 || out != "log.filepath=/var/log/a\nlog.level=info\n" {
+		t.Errorf("Unexpected result of list: %d %q", status, out)
+	}
+
+	status, out, _ = runWith(store, nil, "list")
+	if status != 0 || strings.Count(out, "\n") != 3 {
+		t.Errorf("Unexpected result of list of all: %d %q", status, out)
+	}
+
+	status, out, _ = runWith(store, nil, "list", "-prefix", "log",
+		"-sensitive", "*.filepath")
+	if status != 0 || out != "log.filepath="+flexconfig.RedactedValue+
+		"\nlog.level=info\n" {
+		t.Errorf("Unexpected result of list of sensitive: %d %q", status, out)
+	}
+
+	status, _, _ = runWith(store, nil, "delete", "log.level")
+	if _, exists := store.kvs["log.level"]; status != 0 || exists {
+		t.Errorf("Unexpected result of delete: %d %v", status, store.kvs)
+	}
+
+	status, _, _ = runWith(store, nil, "delete", "log")
+	if status != 0 || len(store.kvs) != 1 || store.kvs["logger.name"] != "main" {
+		t.Errorf("Expected delete of log to keep logger.name: %d %v", status,
+			store.kvs)
+	}
+}
+
+func Test_main_watch(t *testing.T) {
+	store := &fakeStore{kvs: map[string]string{},
+		events: []flexconfig.WatchEvent{
+			{Key: "log.level", Value: "debug"},
+			{Key: "logger.name", Value: "main"},
+			{Key: "log.level", Deleted: true},
+		}}
+
+	status, out, _ := runWith(store, nil, "watch", "log")
+	if status != 0 || out != "log.level=debug\ndeleted log.level\n" {
+		t.Errorf("Unexpected result of watch: %d %q", status, out)
+	}
+
+	status, out, _ = runWith(store, nil, "watch", "-sensitive", "log.level",
+		"log")
+	if status != 0 ||
+		out != "log.level="+flexconfig.RedactedValue+"\ndeleted log.level\n" {
+		t.Errorf("Unexpected result of sensitive watch: %d %q", status, out)
+	}
+
+	store.events = append(store.events,
+		flexconfig.WatchEvent{Err: flexconfig.ErrStoreWatchEnded})
+	status, out, errOut := runWith(store, nil, "watch", "log")
+	if status != 1 || out != "log.level=debug\ndeleted log.level\n" ||
+		!strings.Contains(errOut, flexconfig.ErrStoreWatchEnded.Error()) {
+		t.Errorf("Expected failed watch to exit 1: %d %q %q", status, out,
+			errOut)
+	}
+}
+
+func Test_main_flags(t *testing.T) {
+	store := &fakeStore{kvs: map[string]string{}}
+	env := map[string]string{
+		"ETCDCTL_ENDPOINTS":   "10.0.0.1:2379",
+		"FLEXCONFIG_PREFIX":   "/example",
+		"FLEXCONFIG_USER":     "admin",
+		"FLEXCONFIG_PASSWORD": "secret",
+	}
+
+	runWith(store, env, "list")
+	if store.prefix != "/example|10.0.0.1:2379|admin:secret" {
+		t.Errorf("Unexpected settings from environment: %s", store.prefix)
+	}
+
+	env["FLEXCONFIG_ENDPOINTS"] = "10.0.0.2:2379"
+	runWith(store, env, "-endpoints", "a:2379, b:2379", "-prefix", "/other",
+		"list")
+	if store.prefix != "/other|a:2379,b:2379|admin:secret" {
+		t.Errorf("Unexpected settings from flags: %s", store.prefix)
+	}
+
+	runWith(store, env, "list")
+	if !strings.HasPrefix(store.prefix, "/example|10.0.0.2:2379|") {
+		t.Errorf("Expected FLEXCONFIG_ENDPOINTS to take precedence: %s",
+			store.prefix)
+	}
+
+	for _, args := range [][]string{{}, {"get"}, {"set", "a"},
+		{"list", "extra"}, {"watch", "a", "b"}, {"unknown"}} {
+		status, _, _ := runWith(store, env, args...)
+		if status != 2 {
+			t.Errorf("Expected usage error for %v, found %d", args, status)
+		}
+	}
+}
+
+func Test_main_transfer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigCommand")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/seed.conf"
+	ioutil.WriteFile(filename, []byte("log:\n  level: info\n"+
+		"db:\n  password: secret\n"), 0600)
+
+	store := &fakeStore{kvs: map[string]string{}}
+	status, out, _ := runWith(store, nil, "import", "-dry-run",
+		"-format", "yaml", "-sensitive", "*.password", filename)
+	if status != 0 || len(store.kvs) != 0 ||
+		out != "+ db.password = ******** ("+filename+":4)\n"+
+			"+ log.level = info ("+filename+":2)\n" {
+		t.Errorf("Unexpected result of dry run: %d %q", status, out)
+	}
+
+	status, _, _ = runWith(store, nil, "import", filename)
+	if status != 0 || store.kvs["db.password"] != "secret" {
+		t.Errorf("Unexpected result of import: %d %v", status, store.kvs)
+	}
+
+	status, _, _ = runWith(store, nil, "export", "-format", "ini",
+		dir+"/dump.conf")
+	contents, _ := ioutil.ReadFile(dir + "/dump.conf")
+	if status != 0 || !strings.Contains(string(contents), "[db]") {
+		t.Errorf("Unexpected result of export: %d %s", status, contents)
+	}
+
+	status, _, _ = runWith(store, nil, "export", "-format", "toml", filename)
+	if status != 2 {
+		t.Errorf("Expected usage error for an unknown format, found %d",
+			status)
+	}
+}
+
+func Test_main_reconcile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigCommand")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/app.yaml", []byte("log:\n  level: info\n"), 0600)
+
+	store := &fakeStore{kvs: map[string]string{"stale": "old"}}
+	status, out, _ := runWith(store, nil, "plan", "-prune", dir)
+	if status != 0 || len(store.kvs) != 1 ||
+		out != "+ log.level = info ("+dir+"/app.yaml:2)\n"+
+			"- stale = old (configuration store)\n" {
+		t.Errorf("Unexpected result of plan: %d %q", status, out)
+	}
+
+	status, _, _ = runWith(store, nil, "apply", dir)
+	if status != 0 || len(store.kvs) != 2 || store.kvs["log.level"] != "info" {
+		t.Errorf("Unexpected result of apply: %d %v", status, store.kvs)
+	}
+
+	status, _, _ = runWith(store, nil, "apply", "-prune", dir)
+	if status != 0 || len(store.kvs) != 1 {
+		t.Errorf("Unexpected result of apply with prune: %d %v", status,
+			store.kvs)
+	}
+
+	status, _, _ = runWith(store, nil, "plan")
+	if status != 2 {
+		t.Errorf("Expected usage error without a desired state, found %d",
+			status)
+	}
+}
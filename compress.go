@@ -0,0 +1,151 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultMaxDecompressedSize = 64 * 1024 * 1024
+)
+
+var (
+	// ErrDecompressedSizeExceeded indicates the contents of a compressed
+	// configuration file are larger than the limit set by
+	// MaxDecompressedSize in the ConfigurationParameters.
+	ErrDecompressedSizeExceeded = errors.New("Decompressed size limit exceeded")
+)
+
+// Decompressor returns a reader producing the decompressed contents of the
+// compressed data read from r.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+var (
+	decompressorsLock sync.RWMutex
+	decompressors     = map[string]Decompressor{
+		".gz": func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		".zst": func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+
+			return d.IOReadCloser(), nil
+		},
+	}
+)
+
+// RegisterDecompressor adds support for configuration files whose name ends
+// with the specified suffix, such as ".xz", decompressing them with d before
+// they are parsed. Files compressed with gzip (".gz") and zstd (".zst") are
+// supported without registration. Registering a suffix a second time
+// replaces the previous Decompressor, and a nil Decompressor removes support
+// for the suffix. If the reader returned by d is an io.Closer, it is closed
+// once the contents have been read.
+//
+// For example, xz support can be added using a third party package:
+//
+//	flexconfig.RegisterDecompressor(".xz",
+//	    func(r io.Reader) (io.Reader, error) {
+//	        return xz.NewReader(r)
+//	    })
+func RegisterDecompressor(suffix string, d Decompressor) {
+	decompressorsLock.Lock()
+	defer decompressorsLock.Unlock()
+
+	if d == nil {
+		delete(decompressors, suffix)
+		return
+	}
+
+	decompressors[suffix] = d
+}
+
+// compressionSuffix returns the suffix of the name that identifies the file
+// as compressed, or an empty string if the file is not compressed. If more
+// than one registered suffix matches, such as ".gz" and ".tar.gz", the
+// longest is returned.
+func compressionSuffix(name string) string {
+	decompressorsLock.RLock()
+	defer decompressorsLock.RUnlock()
+
+	result := ""
+	for suffix := range decompressors {
+		if len(name) > len(suffix) && strings.HasSuffix(name, suffix) &&
+			len(suffix) > len(result) {
+			result = suffix
+		}
+	}
+
+	return result
+}
+
+// uncompressedName returns the name of a file with any compression suffix
+// removed, so that the remaining suffix identifies the format of the
+// contents.
+func uncompressedName(name string) string {
+	return strings.TrimSuffix(name, compressionSuffix(name))
+}
+
+// decompress returns the decompressed contents of a file compressed in the
+// format identified by the suffix. If the decompressed contents are larger
+// than limit, ErrDecompressedSizeExceeded is returned, protecting against
+// small files that expand to exhaust memory.
+func decompress(contents []byte, suffix string, limit int64) ([]byte, error) {
+	decompressorsLock.RLock()
+	d := decompressors[suffix]
+	decompressorsLock.RUnlock()
+
+	if d == nil {
+		return contents, nil
+	}
+
+	r, err := d(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	if closer, ok := r.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if limit <= 0 {
+		limit = defaultMaxDecompressedSize
+	}
+
+	result, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(result)) > limit {
+		return nil, ErrDecompressedSizeExceeded
+	}
+
+	return result, nil
+}
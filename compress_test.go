@@ -0,0 +1,142 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(contents string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(contents))
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func zstdBytes(contents string) []byte {
+	var buf bytes.Buffer
+	w, _ := zstd.NewWriter(&buf)
+	w.Write([]byte(contents))
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func Test_compress_readFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/gzApp/routes.conf.gz":  {Data: gzipBytes("test.gz.one: from gzip\n")},
+		"etc/gzApp/routes.json.gz":  {Data: gzipBytes(`{"test.gz.two": "from json"}`)},
+		"etc/gzApp/broken.conf.gz":  {Data: []byte("not gzip")},
+		"etc/gzApp/extra.conf.zst":  {Data: zstdBytes("test.zst.one: from zstd\n")},
+		"etc/gzApp/broken.conf.zst": {Data: []byte("not zstd")},
+	}
+
+	v := make(map[string]string)
+	readConfigFiles(v, "gzApp", []string{".conf", ".json"}, &fileOptions{fsys: fsys})
+
+	if len(v) != 3 {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+
+	if v["test.gz.one"] != "from gzip" {
+		t.Errorf("Unexpected value: %s", v["test.gz.one"])
+	}
+
+	if v["test.gz.two"] != "from json" {
+		t.Errorf("Unexpected value: %s", v["test.gz.two"])
+	}
+
+	if v["test.zst.one"] != "from zstd" {
+		t.Errorf("Unexpected value: %s", v["test.zst.one"])
+	}
+}
+
+func Test_compress_sizeLimit(t *testing.T) {
+	contents := "test.gz.big: " + strings.Repeat("x", 4096) + "\n"
+	compressed := gzipBytes(contents)
+
+	_, err := decompress(compressed, ".gz", 1024)
+	if err != ErrDecompressedSizeExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	result, err := decompress(compressed, ".gz", 8192)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if string(result) != contents {
+		t.Errorf("Unexpected contents after decompression")
+	}
+
+	fsys := fstest.MapFS{
+		"etc/bigApp/big.conf.gz": {Data: compressed},
+	}
+
+	v := make(map[string]string)
+	readConfigFiles(v, "bigApp", []string{".conf"},
+		&fileOptions{fsys: fsys, maxDecompressedSize: 1024})
+
+	if len(v) > 0 {
+		t.Errorf("Unexpected properties from oversized file")
+	}
+}
+
+func Test_compress_register(t *testing.T) {
+	RegisterDecompressor(".rev", func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	})
+	defer RegisterDecompressor(".rev", nil)
+
+	if compressionSuffix("app.conf.rev") != ".rev" {
+		t.Errorf("Registered suffix not recognized")
+	}
+
+	if uncompressedName("app.conf.gz") != "app.conf" {
+		t.Errorf("Unexpected name: %s", uncompressedName("app.conf.gz"))
+	}
+
+	if uncompressedName("app.conf") != "app.conf" {
+		t.Errorf("Unexpected name: %s", uncompressedName("app.conf"))
+	}
+
+	if compressionSuffix(".gz") != "" {
+		t.Errorf("Suffix alone recognized as compressed file")
+	}
+
+	RegisterDecompressor(".rev.gz", func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	})
+	defer RegisterDecompressor(".rev.gz", nil)
+
+	for i := 0; i < 10; i++ {
+		if compressionSuffix("app.conf.rev.gz") != ".rev.gz" {
+			t.Errorf("Expected the longest matching suffix, found %s",
+				compressionSuffix("app.conf.rev.gz"))
+			break
+		}
+	}
+}
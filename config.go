@@ -18,11 +18,27 @@ limitations under the License.
 
 import (
 	"errors"
+	"io"
+	"io/fs"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"unicode"
 )
 
+const (
+	sourceDefault     = "default configuration"
+	sourceFile        = "configuration file"
+	sourceSecret      = "secret file"
+	sourceEnvironment = "environment variables"
+	sourceCommandLine = "command line arguments"
+	sourceStore       = "configuration store"
+	sourceSet         = "Set"
+	sourceLoad        = "Load"
+	sourceRestore     = "Restore"
+)
+
 const (
 	defaultAppName                    = ""
 	defaultConfigurationSuffix        = ".conf"
@@ -42,6 +58,10 @@ var (
 	// ErrParmEnvPrefixNotValid indicates an environment prefix uses
 	// characters outside those accepted as property names.
 	ErrParmEnvPrefixNotValid = errors.New("Environment variable prefix not valid")
+
+	// ErrPropertyNameNotValid indicates a property key uses characters
+	// outside those accepted as property names.
+	ErrPropertyNameNotValid = errors.New("Property name not valid")
 )
 
 // Config is the interface used to interact with a FlexibleConfiguration and
@@ -56,15 +76,100 @@ type Config interface {
 	Get(key string) string
 
 	// Set creates or modifies the specified property with the specified
-	// value.
-	Set(key, val string)
+	// value, returning an error if the property cannot be changed.
+	Set(key, val string) error
+}
+
+// ExtendedConfig is implemented by every Config created by this package, and
+// provides the features beyond reading and setting properties. It is
+// obtained from a Config by a type assertion:
+//
+//	ext, ok := cfg.(flexconfig.ExtendedConfig)
+//
+// ExtendedConfig cannot be implemented outside this package, so that methods
+// can be added to it without breaking other implementations of Config.
+type ExtendedConfig interface {
+	Config
+
+	// Load reads configuration contents having the specified format and
+	// sets the properties they define.
+	Load(r io.Reader, format ConfigurationFormat) error
+
+	// Lookup returns the value of the specified property from the
+	// configuration, or an error if the value refers to a property or
+	// resolver that cannot be resolved.
+	Lookup(key string) (string, error)
+
+	// IsSensitive returns whether the value of the specified property
+	// must not be revealed, for example in logs.
+	IsSensitive(key string) bool
+
+	// Lock prevents the specified properties, which may be patterns,
+	// from being changed.
+	Lock(keys ...string)
+
+	// IsLocked returns whether the specified property has been locked.
+	IsLocked(key string) bool
+
+	// Freeze prevents every property from being changed.
+	Freeze()
+
+	// Explain describes where the value of the specified property came
+	// from, followed by the lower priority values it overrides.
+	Explain(key string) []Provenance
+
+	// Export writes the properties of the configuration in the specified
+	// format, optionally redacting sensitive values. Values read from a
+	// secret source are always redacted.
+	Export(w io.Writer, format ConfigurationFormat, redact bool) error
+
+	// Snapshot returns an immutable view of the configuration as it is
+	// now, including the values in the configuration store.
+	Snapshot() (Config, error)
+
+	// Restore returns the memory store to its contents when the snapshot
+	// was taken.
+	Restore(snapshot Config) error
+
+	// UnknownKeys returns the properties that are not one of the known
+	// keys specified in the ConfigurationParameters.
+	UnknownKeys() []UnknownKey
+
+	// WriteReference writes reference documentation for the properties
+	// documented in the ConfigurationParameters in the specified format.
+	WriteReference(w io.Writer, format ReferenceFormat) error
+
+	// extended prevents ExtendedConfig being implemented outside this
+	// package.
+	extended()
 }
 
 // flexibleConfiguration is the handle used to interact with a configuration.
 type flexibleConfiguration struct {
-	appName string
-	store   FlexConfigStore
-	config  map[string]string
+	appName           string
+	iniPrefix         string
+	envPrefixes       []string
+	store             FlexConfigStore
+	config            map[string]string
+	decrypters        map[string]Decrypter
+	sensitive         map[string]bool
+	sensitivePatterns []string
+	sources           map[string][]Provenance
+	resolved          *resolverCache
+	interpolate       bool
+	resolveStore      bool
+	warn              func(warning string)
+	locked            []string
+	frozen            bool
+	aliases           map[string]string
+	aliasLock         sync.Mutex
+	aliasWarned       map[string]bool
+	knownKeys         []string
+	strictKeys        bool
+	keyDocs           []KeyDoc
+	auditSink         AuditSink
+	auditIdentity     string
+	snapshotOf        *flexibleConfiguration
 }
 
 // ConfigurationParameters specifies how a Config should be initialized.
@@ -90,6 +195,12 @@ type flexibleConfiguration struct {
 // for this field is nil, which means environment variables will not be included
 // in the configuration.
 //
+// FileEnvironmentVariables indicates that an environment variable having one
+// of the EnvironmentVariablePrefixes and a name ending in "_FILE" names a file
+// whose contents are the value of the property named by the rest of the
+// variable, rather than defining a property itself. The default is false,
+// which converts such a variable to a property like any other.
+//
 // AcceptedFileSuffixes indicates which files in the directories mentioned
 // for ApplicationName will be read to find configuration properties. If
 // AcceptedFileSuffixes is nil or empty, files with the suffix ".conf" will
@@ -100,6 +211,142 @@ type flexibleConfiguration struct {
 // empty string which will result in property names consisting of only the
 // section and key names in the INI file.
 //
+// DockerSecrets indicates that each file in the directory /run/secrets
+// defines a property, where the file name is converted to the property name
+// in the same way as an environment variable name and the file contents are
+// the property value. SystemdCredentials does the same for the directory
+// named by the environment variable CREDENTIALS_DIRECTORY, which is set by
+// systemd for services using LoadCredential. Properties read from these
+// directories override properties read from configuration files, and are
+// overridden by environment variables. Both default to false.
+//
+// RemoteCacheDirectory specifies the directory used to keep a copy of a
+// configuration file fetched from an http or https URL (see below). The
+// default is a "flexconfig" directory in the user's cache directory.
+//
+// MaxDecompressedSize is the largest size, in bytes, allowed for the
+// contents of a compressed configuration file after it is decompressed.
+// Configuration files with names ending in ".gz" or ".zst", or a suffix
+// added using RegisterDecompressor, are decompressed before being parsed, and
+// are selected using the suffix preceding the compression suffix (for
+// example, "routes.conf.gz" is read when AcceptedFileSuffixes includes
+// ".conf"). Files exceeding the limit are ignored. The default is 64MiB.
+//
+// FileSystem, when non-nil, is searched for configuration files instead of
+// the local file system. The directories listed for ApplicationName, and the
+// location of a single configuration file, are interpreted relative to the
+// root of FileSystem. This allows tests to provide configuration that never
+// touches /etc or $HOME, for example by using an fstest.MapFS.
+//
+// DefaultConfiguration, when non-nil, is a file system whose top level
+// directory holds configuration files, with one of the AcceptedFileSuffixes,
+// defining default property values. These properties have the lowest
+// priority and are overridden by all other sources. An embed.FS can be used
+// to ship default configuration in the application binary; use fs.Sub when
+// the files are embedded in a subdirectory.
+//
+// DecryptionKeyFile names a file holding the base64 encoded 32 byte key
+// used to decrypt property values of the form ENC[aes256gcm,<data>], as
+// created by EncryptValue. If DecryptionKeyFile is empty, the file named by
+// the environment variable FLEXCONFIG_DECRYPTION_KEY_FILE is used, or the
+// key is taken from the environment variable FLEXCONFIG_DECRYPTION_KEY.
+// Decrypters adds support for other encryption schemes, such as age, where
+// the map key is the scheme named in ENC[<scheme>,<data>]. Encrypted values
+// are decrypted when the configuration is read, and NewFlexibleConfiguration
+// returns an error if a value cannot be decrypted. Decrypted properties are
+// treated as sensitive.
+//
+// DisableInterpolation turns off the resolution of references to other
+// properties in property values. By default, a value containing ${key} has
+// the reference replaced by the value of the property key, and a value
+// containing ${key:-default} uses default when key has no value. References
+// are checked for cycles when the configuration is read, and are resolved
+// again on every call to Get so that values from the configuration store are
+// used. The sequence $${ produces a literal ${.
+//
+// ResolveStoreValues allows references to resolvers, such as ${env:HOME} or
+// ${file:/path}, in values read from the configuration store. By default,
+// such references are only resolved in values read from files, environment
+// variables, the command line, Set, or Load, and are left unresolved in
+// values from the store, so that anyone able to write to a shared store
+// cannot use the application to read its environment or local files.
+// References to other properties are resolved in either case.
+//
+// SensitiveKeys lists the keys of properties whose values must not be
+// revealed. Entries may be patterns, such as "*.password" or "*.token",
+// where * matches any sequence of characters. Properties whose values were
+// decrypted, read from a <VAR>_FILE environment variable or a secret
+// directory, or resolved using a sensitive Resolver, are treated as
+// sensitive without being listed. Wherever the library reports property
+// values, the value of a sensitive property is replaced by RedactedValue.
+//
+// FilePermissions specifies what is done when a configuration file on the
+// local file system, or the directory containing it, is writable by its group
+// or other users, or is owned by a user other than those in FileOwners. If
+// FileOwners is empty, files must be owned by root or by the effective user
+// of the process. A file holding properties whose keys match SensitiveKeys
+// must in addition not be readable by its group or other users. With
+// FilePermissionsWarn, a warning is reported and the file is read. With
+// FilePermissionsReject, the file (or every file in the directory) is not
+// read and NewFlexibleConfiguration returns ErrFilePermissionsNotSecure. The
+// default, FilePermissionsIgnore, performs no checks. Files in secret
+// directories and files named by <VAR>_FILE environment variables are checked
+// in the same way. Files in FileSystem, DefaultConfiguration, and at a URL
+// are not checked.
+//
+// SignaturePolicy specifies what is done when a configuration file has no
+// detached signature, or a signature not made by one of TrustedKeys. The
+// signature of a file is read from the file with ".sig" appended to its name,
+// for example "app.conf.sig", and is either a base64 encoded ed25519
+// signature or a minisign signature. Use ParseTrustedKey to create a
+// TrustedKey from a base64 public key or a minisign public key file. With
+// SignaturesSkip, the file is not read. With SignaturesWarn, a warning is
+// reported and the file is read. With SignaturesFail, the file is not read
+// and NewFlexibleConfiguration returns an error. The default,
+// SignaturesIgnore, does not verify signatures. Files in DefaultConfiguration
+// are not verified; the signature of a file at a URL is fetched from the URL
+// with ".sig" appended to its path, and cached with the file.
+//
+// LockedKeys lists the keys of properties that cannot be changed once the
+// configuration has been read. Entries may be patterns in the same way as
+// SensitiveKeys. LockCommandLineArguments additionally locks every property
+// set by a command line argument. Locked properties are not read from the
+// configuration store. More properties can be locked by calling Lock, and
+// every property by calling Freeze.
+//
+// KeyAliases maps deprecated keys to the keys replacing them, such as
+// "old.key" to "new.key", to allow keys to be renamed. When the new key has
+// no value in any source, including the configuration store, the value of
+// the old key is used instead, and a warning naming the source of the old
+// key is reported the first time it is used. Aliases are not followed
+// transitively. The old keys are treated as known keys.
+//
+// KnownKeys lists the keys of the properties the application uses, so that
+// misspelled keys, which would otherwise have no effect, can be detected.
+// Entries may be patterns in the same way as SensitiveKeys, such as
+// "database.*". Each property read, or set by Load, that is not known is
+// reported as a warning naming its source and the nearest known key. If
+// StrictKeys is true, NewFlexibleConfiguration and Load instead return
+// ErrUnknownProperty. No checks are made if KnownKeys is empty.
+//
+// KeyDocs documents the properties the application uses, with a
+// description, type, default, and example for each. WriteReference uses them
+// to generate reference documentation as Markdown, a man page, or text for
+// help output. Documented keys are also known keys, in addition to those in
+// KnownKeys. The defaults are documentation only, and are not applied to the
+// configuration.
+//
+// AuditSink, when non-nil, receives an AuditEvent for every call to Set or
+// Load that changes, or attempts to change, a property. AuditIdentity is
+// recorded as the author of each change; if empty, the name of the user
+// running the process is used. NewFileAuditSink creates an AuditSink writing
+// events to a file as lines of JSON. Changes made directly to a
+// FlexConfigStore can be recorded using NewAuditedFlexConfigStore.
+//
+// WarningHandler is called with a description of each problem the library
+// reports without failing, such as an insecure configuration file. If nil,
+// warnings are written using the standard logger.
+//
 // ConfigurationStore is an interface to a configuration store. When it is
 // non-nil all interactions with the configuration will consult with the
 // configuration store before asking the in-memory store resulting from
@@ -108,11 +355,39 @@ type flexibleConfiguration struct {
 type ConfigurationParameters struct {
 	ApplicationName             string
 	EnvironmentVariablePrefixes []string
+	FileEnvironmentVariables    bool
 	AcceptedFileSuffixes        []string
 	IniNamePrefix               string
+	DockerSecrets               bool
+	SystemdCredentials          bool
+	RemoteCacheDirectory        string
+	MaxDecompressedSize         int64
+	FileSystem                  fs.FS
+	DefaultConfiguration        fs.FS
+	DecryptionKeyFile           string
+	Decrypters                  map[string]Decrypter
+	DisableInterpolation        bool
+	ResolveStoreValues          bool
+	SensitiveKeys               []string
+	FilePermissions             FilePermissionPolicy
+	FileOwners                  []int
+	SignaturePolicy             SignaturePolicy
+	TrustedKeys                 []TrustedKey
+	LockedKeys                  []string
+	LockCommandLineArguments    bool
+	KeyAliases                  map[string]string
+	KnownKeys                   []string
+	StrictKeys                  bool
+	KeyDocs                     []KeyDoc
+	AuditSink                   AuditSink
+	AuditIdentity               string
+	WarningHandler              func(warning string)
 	ConfigurationStore          FlexConfigStore
 }
 
+// extended marks flexibleConfiguration as implementing ExtendedConfig.
+func (fc *flexibleConfiguration) extended() {}
+
 // configuration is a singleton holding the current static configuration.
 var configuration *flexibleConfiguration
 
@@ -152,10 +427,68 @@ func NewFlexibleConfiguration(
 		parameters.AcceptedFileSuffixes = []string{defaultConfigurationSuffix}
 	}
 
-	configuration = new(flexibleConfiguration)
-	configuration.appName = parameters.ApplicationName
-	configuration.store = parameters.ConfigurationStore
-	configuration.config = configuration.readConfig(parameters)
+	if len(parameters.RemoteCacheDirectory) == 0 {
+		parameters.RemoteCacheDirectory = defaultRemoteCacheDirectory()
+	}
+
+	if parameters.SignaturePolicy != SignaturesIgnore &&
+		len(parameters.TrustedKeys) == 0 {
+		return nil, ErrTrustedKeysRequired
+	}
+
+	decrypters, err := newDecrypters(parameters.DecryptionKeyFile,
+		parameters.Decrypters)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := new(flexibleConfiguration)
+	fc.appName = parameters.ApplicationName
+	fc.iniPrefix = parameters.IniNamePrefix
+	fc.envPrefixes = parameters.EnvironmentVariablePrefixes
+	fc.store = parameters.ConfigurationStore
+	fc.decrypters = decrypters
+	fc.sensitive = make(map[string]bool)
+	fc.sensitivePatterns = parameters.SensitiveKeys
+	fc.sources = make(map[string][]Provenance)
+	fc.resolved = newResolverCache()
+	fc.interpolate = !parameters.DisableInterpolation
+	fc.resolveStore = parameters.ResolveStoreValues
+	fc.warn = parameters.WarningHandler
+	if fc.warn == nil {
+		fc.warn = defaultWarningHandler
+	}
+
+	fc.config, err = fc.readConfig(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	fc.Lock(parameters.LockedKeys...)
+
+	fc.aliases = parameters.KeyAliases
+	fc.knownKeys = append([]string(nil), parameters.KnownKeys...)
+	for _, doc := range parameters.KeyDocs {
+		fc.knownKeys = append(fc.knownKeys, doc.Key)
+	}
+
+	fc.keyDocs = parameters.KeyDocs
+	fc.strictKeys = parameters.StrictKeys
+	err = fc.checkKnownKeys(fc.config, func(k string) Provenance {
+		source, _ := currentProvenance(fc.sources, k)
+		return source
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fc.auditSink = parameters.AuditSink
+	fc.auditIdentity = parameters.AuditIdentity
+	if fc.auditSink != nil && len(fc.auditIdentity) == 0 {
+		fc.auditIdentity = defaultAuditIdentity()
+	}
+
+	configuration = fc
 
 	return configuration, nil
 }
@@ -181,19 +514,7 @@ func (fc *flexibleConfiguration) Exists(key string) bool {
 		return false
 	}
 
-	if fc.store != nil {
-		val, err := fc.store.Get(k)
-		if err == nil && len(val) > 0 {
-			return true
-		}
-	}
-
-	val, exists := fc.config[k]
-	if !exists {
-		return false
-	}
-
-	return len(val) > 0
+	return len(fc.getValue(k)) > 0
 }
 
 // Get returns the value for the specified key from the global configuration.
@@ -212,20 +533,97 @@ func Get(key string) string {
 // The configuration store, if set, is checked first. If not found in the
 // configuration store or the store was not set, the key is retrieved from
 // the memory store created from files, environment variables, and arguments.
+// References to other properties in the value are resolved, using the
+// current values of the referenced properties. If a reference cannot be
+// resolved, the value is returned with its references unresolved.
 func (fc *flexibleConfiguration) Get(key string) string {
 	k := strings.TrimSpace(key)
 	if len(k) == 0 {
 		return ""
 	}
 
-	if fc.store != nil {
+	val, err := fc.Lookup(k)
+	if err != nil {
+		return fc.getValue(k)
+	}
+
+	return val
+}
+
+// Lookup returns the value for the specified key from the configuration in
+// the same way as Get, but returns an error if a reference in the value
+// cannot be resolved. The error names the property containing the reference
+// and the source of that property.
+func (fc *flexibleConfiguration) Lookup(key string) (string, error) {
+	k := strings.TrimSpace(key)
+	if len(k) == 0 {
+		return "", nil
+	}
+
+	val := fc.getValue(k)
+	if !fc.interpolate {
+		return val, nil
+	}
+
+	ip := newInterpolator(fc.getValue)
+	ip.resolvers = lookupResolver
+	ip.cache = fc.resolved
+	ip.source = fc.sourceOf
+	ip.sensitive = fc.IsSensitive
+	if !fc.resolveStore {
+		ip.trusted = fc.notFromStore
+	}
+
+	return ip.resolveProperty(k, val)
+}
+
+// notFromStore returns whether the current value of a property was not read
+// from the configuration store.
+func (fc *flexibleConfiguration) notFromStore(k string) bool {
+	_, _, fromStore := fc.lookupValue(k)
+	return !fromStore
+}
+
+// sourceOf returns a description of where the current value of a property
+// was defined.
+func (fc *flexibleConfiguration) sourceOf(k string) string {
+	key, _, fromStore := fc.lookupValue(k)
+	if fromStore {
+		return sourceStore
+	}
+
+	source, exists := currentProvenance(fc.sources, key)
+	if !exists {
+		return "unknown source"
+	}
+
+	return source.String()
+}
+
+// getValue returns the unresolved value for the specified key, checking the
+// configuration store first and then the memory store. If the key has no
+// value, the value of a deprecated key aliased to it is returned.
+func (fc *flexibleConfiguration) getValue(k string) string {
+	key, val, _ := fc.lookupValue(k)
+	if key != k {
+		fc.warnDeprecated(key, k)
+	}
+
+	return val
+}
+
+// storedValue returns the unresolved value for a single key, checking the
+// configuration store first if useStore is true and then the memory store,
+// and whether the value came from the configuration store.
+func (fc *flexibleConfiguration) storedValue(k string, useStore bool) (string, bool) {
+	if useStore {
 		val, err := fc.store.Get(k)
 		if err == nil && len(val) > 0 {
-			return val
+			return val, true
 		}
 	}
 
-	return fc.config[k]
+	return fc.config[k], false
 }
 
 // Set stores the key with value in the global configuration. If the global
@@ -234,63 +632,193 @@ func (fc *flexibleConfiguration) Get(key string) string {
 // already exists, its value will be overwritten. If the configuration store
 // is set, the key with value will be stored in both the configuration store
 // as well as the memory store. Otherwise, it will be stored only in the memory
-// store.
-func Set(key string, val string) {
+// store. An error is returned if the property is locked or the configuration
+// is frozen.
+func Set(key string, val string) error {
 	cfg := GetConfiguration()
-	cfg.Set(key, val)
+	return cfg.Set(key, val)
 }
 
 // Set stores the key with value in the configuration. If they key already
 // exists, its value will be overwritten. If the configuration store is set,
 // the key with value will be stored in both the configuration store as well
 // as the memory store. Otherwise, it will be stored only in the memory
-// store.
-func (fc *flexibleConfiguration) Set(key, val string) {
+// store. A property that is locked, or any property once the configuration
+// is frozen, is not changed and an error is returned. An error writing to
+// the configuration store is returned after the memory store is updated.
+func (fc *flexibleConfiguration) Set(key, val string) error {
 	k := strings.TrimSpace(key)
 	if !propertyNameIsValid(k) {
-		return
+		return ErrPropertyNameNotValid
+	}
+
+	old := fc.getValue(k)
+	err := fc.checkWritable(k)
+	if err != nil {
+		fc.audit(auditOperationSet, k, old, val, sourceSet, err)
+		return err
 	}
 
+	var storeErr error
 	if fc.store != nil {
-		fc.store.Set(key, val)
+		storeErr = fc.store.Set(key, val)
 		// even if the store saves the property, save it in memory
 	}
 
+	if fc.config == nil {
+		fc.config = make(map[string]string)
+	}
+
 	fc.config[key] = val
+	if fc.sources != nil {
+		recordProvenance(fc.sources, key,
+			Provenance{Layer: sourceSet, Value: val})
+	}
+
+	fc.audit(auditOperationSet, k, old, val, sourceSet, storeErr)
+
+	return storeErr
+}
+
+// Load reads configuration contents having the specified format from r and
+// sets the properties they define in the memory store, overriding properties
+// read from files, environment variables, and arguments. The properties are
+// not written to the configuration store. If format is
+// ConfigurationFormatUnknown, the format is detected from the contents. No
+// properties are set if any of them is locked or the configuration is frozen,
+// or if any of them is not known and StrictKeys was specified.
+func (fc *flexibleConfiguration) Load(
+	r io.Reader,
+	format ConfigurationFormat) error {
+	vars, err := ReadProperties(r, format, fc.iniPrefix)
+	if err != nil {
+		return err
+	}
+
+	err = fc.checkAllWritable(vars)
+	if err == nil {
+		err = fc.checkKnownKeys(vars, func(k string) Provenance {
+			return Provenance{Layer: sourceLoad}
+		})
+	}
+
+	if err != nil {
+		fc.audit(auditOperationLoad, "", "", "", sourceLoad, err)
+		return err
+	}
+
+	decrypted, err := decryptValues(vars, fc.decrypters)
+	if err != nil {
+		return err
+	}
+
+	if fc.config == nil {
+		fc.config = make(map[string]string)
+	}
+
+	if fc.sensitive == nil {
+		fc.sensitive = make(map[string]bool)
+	}
+
+	if fc.sources == nil {
+		fc.sources = make(map[string][]Provenance)
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		old := fc.getValue(k)
+		fc.config[k] = vars[k]
+		fc.sensitive[k] = decrypted[k]
+		recordProvenance(fc.sources, k,
+			Provenance{Layer: sourceLoad, Value: vars[k]})
+		fc.audit(auditOperationLoad, k, old, vars[k], sourceLoad, nil)
+	}
+
+	return nil
 }
 
 // readConfig uses the configuration parameters to read various aspects of
-// the local configuration.
+// the local configuration. Encrypted property values are decrypted once all
+// sources have been read, and references between properties are checked.
 func (fc *flexibleConfiguration) readConfig(
-	parameters ConfigurationParameters) map[string]string {
+	parameters ConfigurationParameters) (map[string]string, error) {
 	// Read configuration in reverse priority order (lowest priority
 	// first) so that a property from a higher priority source will
 	// override a previous definition.
 
 	vars := make(map[string]string)
 	readFiles := true
+	opts := &fileOptions{
+		fsys:                parameters.FileSystem,
+		iniPrefix:           parameters.IniNamePrefix,
+		cacheDir:            parameters.RemoteCacheDirectory,
+		maxDecompressedSize: parameters.MaxDecompressedSize,
+		sources:             fc.sources,
+	}
+
+	if parameters.FilePermissions != FilePermissionsIgnore {
+		opts.permissions = &permissionCheck{
+			policy:            parameters.FilePermissions,
+			owners:            parameters.FileOwners,
+			sensitivePatterns: parameters.SensitiveKeys,
+			warn:              fc.warn,
+		}
+	}
+
+	if parameters.SignaturePolicy != SignaturesIgnore {
+		opts.signatures = &signatureCheck{
+			policy: parameters.SignaturePolicy,
+			keys:   parameters.TrustedKeys,
+			warn:   fc.warn,
+		}
+	}
+
+	// default configuration has the lowest priority of all
+	if parameters.DefaultConfiguration != nil {
+		readDefaultFiles(vars,
+			parameters.DefaultConfiguration,
+			parameters.AcceptedFileSuffixes,
+			opts)
+	}
+
+	// A single configuration file is read into its own map, so that a
+	// file specified by the command line argument can replace the file
+	// specified by the environment variable.
+	singleVars := make(map[string]string)
+	singleOpts := *opts
+	singleOpts.sources = make(map[string][]Provenance)
 
 	// Check if environment variable specifies the location of a
 	// single cconfiguration file.
 	configFile := os.Getenv(flexConfigEnvFileLocation)
 	if len(configFile) > 0 {
-		readSingleConfigFile(vars, configFile, parameters.IniNamePrefix)
-		if len(vars) > 0 {
-			readFiles = false
-		}
+		readSingleConfigFile(singleVars, configFile, &singleOpts)
 	}
 
 	// Check if a command line argument is used to specify the location
 	// of a single configuration file.
 	configFile = searchArgument(os.Args, flexconfigCommandlineFileLocation)
 	if len(configFile) > 0 {
-		if len(vars) > 0 {
-			vars = make(map[string]string)
+		if len(singleVars) > 0 {
+			singleVars = make(map[string]string)
+			singleOpts.sources = make(map[string][]Provenance)
 		}
 
-		readSingleConfigFile(vars, configFile, parameters.IniNamePrefix)
-		if len(vars) > 0 {
-			readFiles = false
+		readSingleConfigFile(singleVars, configFile, &singleOpts)
+	}
+
+	if len(singleVars) > 0 {
+		readFiles = false
+		for k, v := range singleVars {
+			vars[k] = v
+			fc.sources[k] = append(fc.sources[k],
+				singleOpts.sources[k]...)
 		}
 	}
 
@@ -299,25 +827,109 @@ func (fc *flexibleConfiguration) readConfig(
 		readConfigFiles(vars,
 			parameters.ApplicationName,
 			parameters.AcceptedFileSuffixes,
-			parameters.IniNamePrefix)
+			opts)
 	}
 
-	// environment variables override file property definitions
+	if opts.signatures != nil && opts.signatures.err != nil {
+		return nil, opts.signatures.err
+	}
+
+	// secret files override file property definitions
+	readSecretDirectories(vars, fc.sources, fc.sensitive,
+		parameters.DockerSecrets,
+		parameters.SystemdCredentials,
+		opts.permissions)
+
+	// environment variables override file and secret property definitions
 	if parameters.EnvironmentVariablePrefixes != nil &&
 		len(parameters.EnvironmentVariablePrefixes) > 0 {
-		readEnvVars(vars, parameters.EnvironmentVariablePrefixes)
+		envs := os.Environ()
+		envVars := make(map[string]string)
+		envNames := make(map[string]string)
+		readEnvVars(envVars, envNames, envs,
+			parameters.EnvironmentVariablePrefixes,
+			parameters.FileEnvironmentVariables,
+			opts.permissions)
+		mergeProperties(vars, envVars, fc.sources,
+			func(k string) Provenance {
+				return Provenance{Layer: sourceEnvironment,
+					EnvVar: envNames[k]}
+			})
+
+		if parameters.FileEnvironmentVariables {
+			for _, k := range fileEnvVarKeys(envs,
+				parameters.EnvironmentVariablePrefixes) {
+				fc.sensitive[k] = true
+			}
+		}
+	}
+
+	// secret and environment variable files are checked as configuration
+	// files are
+	if opts.permissions != nil && opts.permissions.err != nil {
+		return nil, opts.permissions.err
 	}
 
 	// command line arguments override all other local configuration
-	readCommandLineArgs(vars, os.Args)
+	argVars := make(map[string]string)
+	readCommandLineArgs(argVars, os.Args)
+	mergeProperties(vars, argVars, fc.sources, func(k string) Provenance {
+		return Provenance{Layer: sourceCommandLine,
+			Argument: commandLineArgIndex(os.Args, k)}
+	})
+
+	if parameters.LockCommandLineArguments {
+		for k := range argVars {
+			fc.Lock(k)
+		}
+	}
+
+	decrypted, err := decryptValues(vars, fc.decrypters)
+	if err != nil {
+		return nil, err
+	}
+
+	for k := range decrypted {
+		fc.sensitive[k] = true
+	}
+
+	if fc.interpolate {
+		err = checkReferences(vars)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return vars
+	return vars, nil
+}
+
+// mergeProperties copies the properties read from a single source into vars,
+// recording the source of each property as described by the origin
+// function.
+func mergeProperties(
+	vars, layer map[string]string,
+	sources map[string][]Provenance,
+	origin func(k string) Provenance) {
+	for k, v := range layer {
+		vars[k] = v
+		p := origin(k)
+		p.Value = v
+		recordProvenance(sources, k, p)
+	}
 }
 
 // readSingleConfigFile reads properties set in a single configuration file.
+// The location of the file may be a path on the local file system or an
+// http or https URL.
 func readSingleConfigFile(
 	vars map[string]string,
-	configFile, iniNamePrefix string) {
+	configFile string,
+	opts *fileOptions) {
+	if isRemoteLocation(configFile) {
+		readRemoteConfigFile(vars, configFile, opts)
+		return
+	}
+
 	// Break file name into path and name and read the file at
 	// that location.
 
@@ -332,7 +944,11 @@ func readSingleConfigFile(
 		name = configFile[index+1:]
 	}
 
-	readConfigFile(vars, path, name, iniNamePrefix)
+	if opts.fsys == nil && !opts.permissions.allow(path, false) {
+		return
+	}
+
+	readConfigFile(vars, path, name, opts)
 }
 
 // nameIsValid returns whether the specified application name or environment
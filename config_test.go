@@ -19,7 +19,9 @@ limitations under the License.
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func Test_config_getBeforeInitialized(t *testing.T) {
@@ -513,3 +515,96 @@ func Test_readConfig_specialBoth(t *testing.T) {
 		t.Errorf("Command line config did not override environment")
 	}
 }
+
+func Test_config_fileSystem(t *testing.T) {
+	os.Args = []string{}
+	os.Unsetenv(flexConfigEnvFileLocation)
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "fsConfig",
+		FileSystem: fstest.MapFS{
+			"etc/fsConfig/app.conf": {Data: []byte("test.fs.value: from etc\n")},
+		},
+		DefaultConfiguration: fstest.MapFS{
+			"defaults.conf": {Data: []byte("test.fs.value: default\ntest.fs.other: default\n")},
+		},
+	})
+	if err != nil {
+		t.Errorf("Error calling NewFlexibleConfiguration: %v", err)
+		return
+	}
+
+	if c.Get("test.fs.value") != "from etc" {
+		t.Errorf("Unexpected value: %s", c.Get("test.fs.value"))
+	}
+
+	if c.Get("test.fs.other") != "default" {
+		t.Errorf("Unexpected value: %s", c.Get("test.fs.other"))
+	}
+}
+
+func Test_config_load(t *testing.T) {
+	os.Args = []string{}
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		IniNamePrefix: "loaded",
+	})
+	if err != nil {
+		t.Errorf("Error calling NewFlexibleConfiguration: %v", err)
+		return
+	}
+
+	err = c.(ExtendedConfig).Load(strings.NewReader("[sect]\nkey=value\n"),
+		ConfigurationFormatINI)
+	if err != nil {
+		t.Errorf("Unexpected error loading: %v", err)
+	}
+
+	if c.Get("loaded.sect.key") != "value" {
+		t.Errorf("Unexpected value: %s", c.Get("loaded.sect.key"))
+	}
+
+	err = c.(ExtendedConfig).Load(strings.NewReader("a: [unterminated"),
+		ConfigurationFormatYAML)
+	if err == nil {
+		t.Errorf("Unexpected success loading bad contents")
+	}
+}
+
+// minimalConfig implements only the methods required of a Config.
+type minimalConfig map[string]string
+
+func (mc minimalConfig) Exists(key string) bool {
+	_, exists := mc[key]
+	return exists
+}
+
+func (mc minimalConfig) Get(key string) string {
+	return mc[key]
+}
+
+func (mc minimalConfig) Set(key, val string) error {
+	mc[key] = val
+	return nil
+}
+
+func Test_config_extended(t *testing.T) {
+	var c Config = minimalConfig{}
+	c.Set("a", "b")
+	if _, ok := c.(ExtendedConfig); ok || c.Get("a") != "b" {
+		t.Errorf("Unexpected minimal Config")
+	}
+
+	os.Args = []string{}
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{})
+	if err != nil {
+		t.Errorf("Error calling NewFlexibleConfiguration: %v", err)
+		return
+	}
+
+	if _, ok := c.(ExtendedConfig); !ok {
+		t.Errorf("Expected the configuration to implement ExtendedConfig")
+	}
+
+	if _, ok := GetConfiguration().(ExtendedConfig); !ok {
+		t.Errorf("Expected the global configuration to implement ExtendedConfig")
+	}
+}
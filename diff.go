@@ -0,0 +1,194 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+)
+
+// ChangeType is an enumerated type defining how a property differs between
+// two configurations.
+type ChangeType int
+
+const (
+	// ChangeUnknown is a value of ChangeType indicating the kind of
+	// change is unknown.
+	ChangeUnknown ChangeType = iota
+
+	// ChangeAdded is a value of ChangeType indicating the property is
+	// set only in the second configuration.
+	ChangeAdded
+
+	// ChangeRemoved is a value of ChangeType indicating the property is
+	// set only in the first configuration.
+	ChangeRemoved
+
+	// ChangeModified is a value of ChangeType indicating the property has
+	// different values in the two configurations.
+	ChangeModified
+)
+
+var (
+	// ErrConfigurationNotComparable indicates a Config passed to Diff was
+	// not created by this package.
+	ErrConfigurationNotComparable = errors.New("Configuration cannot be compared")
+)
+
+// Change describes a property that differs between two configurations.
+// OldValue and OldSource describe the property in the first configuration,
+// and are empty for an added property; NewValue and NewSource describe it in
+// the second, and are empty for a removed property. The values of sensitive
+// properties are replaced by RedactedValue.
+type Change struct {
+	Type      ChangeType
+	Key       string
+	OldValue  string
+	NewValue  string
+	OldSource Provenance
+	NewSource Provenance
+}
+
+// propertyLister is implemented by the configurations Diff can compare.
+type propertyLister interface {
+	ExtendedConfig
+	effectiveProperties() map[string]string
+}
+
+// Diff compares two configurations, such as staging and production or a
+// snapshot and the live configuration, returning the properties that were
+// added, removed, or changed in going from the first to the second, in
+// order of key. Values are compared as Get returns them, and a property is
+// treated as sensitive if it is sensitive in either configuration.
+func Diff(from, to Config) ([]Change, error) {
+	fromLister, ok := from.(propertyLister)
+	if !ok {
+		return nil, ErrConfigurationNotComparable
+	}
+
+	toLister, ok := to.(propertyLister)
+	if !ok {
+		return nil, ErrConfigurationNotComparable
+	}
+
+	fromVars := fromLister.effectiveProperties()
+	toVars := toLister.effectiveProperties()
+
+	keys := sortedKeys(fromVars)
+	for k := range toVars {
+		if _, exists := fromVars[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var changes []Change
+	for _, k := range keys {
+		oldValue, inFrom := fromVars[k]
+		newValue, inTo := toVars[k]
+		if inFrom && inTo && oldValue == newValue {
+			continue
+		}
+
+		c := Change{Type: ChangeModified, Key: k}
+		if !inFrom {
+			c.Type = ChangeAdded
+		} else if !inTo {
+			c.Type = ChangeRemoved
+		}
+
+		sensitive := fromLister.IsSensitive(k) || toLister.IsSensitive(k)
+		if inFrom {
+			c.OldValue = diffValue(oldValue, sensitive)
+			c.OldSource = diffSource(fromLister, k)
+		}
+
+		if inTo {
+			c.NewValue = diffValue(newValue, sensitive)
+			c.NewSource = diffSource(toLister, k)
+		}
+
+		changes = append(changes, c)
+	}
+
+	return changes, nil
+}
+
+// diffValue returns the value to report for a property, redacted if it is
+// sensitive.
+func diffValue(val string, sensitive bool) string {
+	if sensitive {
+		return redactValue(val)
+	}
+
+	return val
+}
+
+// diffSource returns the source of the current value of a property, without
+// its value.
+func diffSource(cfg ExtendedConfig, k string) Provenance {
+	chain := cfg.Explain(k)
+	if len(chain) == 0 {
+		return Provenance{}
+	}
+
+	source := chain[0]
+	source.Value = ""
+
+	return source
+}
+
+// WriteDiff writes the changes to w as text, one line for each property:
+// "+" followed by the new value for an added property, "-" followed by the
+// old value for a removed property, and "~" followed by the old and new
+// values for a changed property, each with its source.
+func WriteDiff(w io.Writer, changes []Change) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range changes {
+		switch c.Type {
+		case ChangeAdded:
+			bw.WriteString("+ " + c.Key + " = " + c.NewValue +
+				" (" + c.NewSource.String() + ")\n")
+		case ChangeRemoved:
+			bw.WriteString("- " + c.Key + " = " + c.OldValue +
+				" (" + c.OldSource.String() + ")\n")
+		default:
+			bw.WriteString("~ " + c.Key + " = " + c.OldValue +
+				" (" + c.OldSource.String() + ") -> " + c.NewValue +
+				" (" + c.NewSource.String() + ")\n")
+		}
+	}
+
+	return bw.Flush()
+}
+
+// String returns the string representation of the ChangeType.
+func (ct ChangeType) String() string {
+	switch ct {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,101 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_diff_configurations(t *testing.T) {
+	os.Args = []string{}
+
+	parameters := ConfigurationParameters{SensitiveKeys: []string{"*.password"}}
+	staging, err := NewFlexibleConfiguration(parameters)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	staging.Set("app.level", "debug")
+	staging.Set("app.name", "svc")
+	staging.Set("db.password", "one")
+	staging.Set("staging.only", "x")
+
+	production, err := NewFlexibleConfiguration(parameters)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	production.Set("app.name", "svc")
+	production.Set("app.level", "info")
+	production.Set("db.password", "two")
+	production.(ExtendedConfig).Load(strings.NewReader("production.only: new\n"),
+		ConfigurationFormatYAML)
+
+	changes, err := Diff(staging, production)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	expected := []Change{
+		{Type: ChangeModified, Key: "app.level", OldValue: "debug",
+			NewValue: "info", OldSource: Provenance{Layer: sourceSet},
+			NewSource: Provenance{Layer: sourceSet}},
+		{Type: ChangeModified, Key: "db.password", OldValue: RedactedValue,
+			NewValue: RedactedValue, OldSource: Provenance{Layer: sourceSet},
+			NewSource: Provenance{Layer: sourceSet}},
+		{Type: ChangeAdded, Key: "production.only", NewValue: "new",
+			NewSource: Provenance{Layer: sourceLoad}},
+		{Type: ChangeRemoved, Key: "staging.only", OldValue: "x",
+			OldSource: Provenance{Layer: sourceSet}},
+	}
+
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes, found %v", len(expected), changes)
+		return
+	}
+
+	for i, c := range expected {
+		if changes[i] != c {
+			t.Errorf("Change %d: expected %+v, found %+v", i, c, changes[i])
+		}
+	}
+
+	var b bytes.Buffer
+	WriteDiff(&b, changes)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 4 ||
+		lines[0] != "~ app.level = debug (Set) -> info (Set)" ||
+		lines[2] != "+ production.only = new (Load)" ||
+		lines[3] != "- staging.only = x (Set)" {
+		t.Errorf("Unexpected text: %s", b.String())
+	}
+
+	changes, _ = Diff(production, production)
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes, found %v", changes)
+	}
+
+	if ChangeAdded.String() != "added" || ChangeType(99).String() != "unknown" {
+		t.Errorf("Unexpected ChangeType names")
+	}
+}
@@ -31,7 +31,9 @@ beginning of its main function by calling NewFlexibleConfiguration. The
 application can specify several parameters about how and where configuration
 properties will be obtained from. Configuration sources include
 (in priority order, lowest to highest):
+    - default configuration (DefaultConfiguration)
     - directories on the local file system
+    - secret directories (/run/secrets and $CREDENTIALS_DIRECTORY)
     - environment variables
     - command line arguments
     - configuration store
@@ -51,6 +53,18 @@ is controlled by AcceptedFileSuffixes, where the suffix ".conf" is used if
 none are specified. The contents of the files may have formats that include
 JSON, YAML, and INI.
 
+Files compressed with gzip or zstd (for example "routes.conf.gz") are
+decompressed before being parsed, subject to MaxDecompressedSize. Other
+compression formats can be added using RegisterDecompressor.
+
+Default property values can be shipped with the application by setting
+DefaultConfiguration to a file system, such as an embed.FS, holding
+configuration files. Setting FileSystem causes configuration files to be
+searched for in that file system rather than the local file system, which
+allows tests to run without reading /etc or $HOME. Configuration contents
+can also be read from any io.Reader using ReadProperties, or added to a
+configuration using the Load method of ExtendedConfig.
+
 Even if the application has been compiled with a value for ApplicationName,
 it is possible to override the behavior of searching for configuration files
 and specify a single configuration
@@ -65,6 +79,22 @@ argument and the
 environment variable are set, the value of the command line argument
 will be used.
 
+The location of the single configuration file may also be an http or https
+URL, allowing configuration to be hosted centrally. The document is fetched
+with a timeout and its format is determined from the Content-Type returned
+by the server or, failing that, from the suffix of the URL path. A copy of
+the document is kept in RemoteCacheDirectory. The cached copy is revalidated
+using the ETag and Last-Modified headers returned by the server, and is used
+when the server cannot be reached.
+
+Secrets can be committed in configuration files in encrypted form. A value
+of the form ENC[aes256gcm,<data>], created using EncryptValue, is decrypted
+when the configuration is read, using the key named by DecryptionKeyFile or
+provided by the environment (see ConfigurationParameters). Other schemes,
+such as age, can be supported by adding a Decrypter to Decrypters. If a
+value cannot be decrypted, NewFlexibleConfiguration returns an error rather
+than using the encrypted text as the property value.
+
 Hierarchical properties (multiple fields separated by dots) are defined by
 parsing JSON and YAML files. Arrays defined in these files result in
 property names that include fields consisting of digits. For example, the
@@ -99,6 +129,20 @@ whereas, specifying "SUN_" will only match
 Environment variable names are converted into the canonical form before
 storing in the configuration.
 
+When FileEnvironmentVariables is set in the ConfigurationParameters, an
+environment variable whose name ends in "_FILE" names a file whose contents
+become the value of the property named by the rest of the variable. For
+example, DB_PASSWORD_FILE=/run/secrets/db defines the property db.password
+with the contents of /run/secrets/db, without the password itself being
+visible in the environment of the process. A variable setting the property
+directly (DB_PASSWORD) takes precedence. Otherwise, such a variable defines a
+property like any other, so LOG_FILE defines log.file.
+
+Secrets provided as files by Docker (/run/secrets) or by systemd
+($CREDENTIALS_DIRECTORY) can be read by setting DockerSecrets or
+SystemdCredentials in the ConfigurationParameters. Each file in these
+directories defines one property.
+
 Command line arguments are checked for property definitions without the
 application needing to manage arguments beyond calling NewFlexibleConfiguration.
 Any argument beginning with a double dash (--) and being all lowercase is used
@@ -112,9 +156,163 @@ will result in the following properties being defined in the configuration:
 Note, the '=' separating name and value is required with no intermediate spaces.
 Single or double quotes can enclose the value of a property.
 
+Property values can refer to other properties. A value such as
+    http://${server.host}:${server.port}/
+has each reference replaced by the value of the referenced property, and
+${key:-default} uses default when key has no value. References are resolved
+each time a property is retrieved, so values from the configuration store are
+used, and a reference cycle is reported as an error when the configuration is
+read. Use $${ to include a literal ${ in a value.
+
+References can also obtain values from outside the configuration using a
+resolver: ${env:HOME} is the value of an environment variable,
+${file:/run/secrets/db} is the contents of a file, and ${base64:aGk=} is the
+decoding of base64 data. Applications can add schemes using
+RegisterResolver. Resolvers are only called when a property using them is
+retrieved, and their results are cached until the configuration is read
+again. Lookup returns an error naming the property and its source when a
+reference cannot be resolved. Resolvers are not used for values read from
+the configuration store, which may be writable by others, unless
+ResolveStoreValues is set.
+
+Secrets held in Vault are read by a resolver created with NewVaultResolver,
+which must be registered before the configuration is read:
+    r, err := flexconfig.NewVaultResolver(flexconfig.VaultConfig{})
+    if err != nil {
+        log.Fatal(err)
+    }
+    flexconfig.RegisterResolver("vault", r)
+A property can then refer to a field of a KV version 2 secret or of a
+dynamic secret with a reference such as
+    db:
+      password: ${vault://secret/data/db#password}
+Like any other resolver, Vault is only consulted for a reference enclosed in
+${ and }, and not when interpolation is disabled: a bare value of
+vault://secret/data/db#password is used as it is. The resolver authenticates
+with a Vault token, caches secrets in memory, and renews the leases of
+dynamic secrets as they are used.
+
+Properties holding secrets are treated as sensitive and their values are
+replaced by RedactedValue wherever the library reports property values.
+Sensitive properties are those matching SensitiveKeys (for example
+"*.password"), those whose values were decrypted or read from a secret file,
+and those whose values refer to a sensitive property or to a Resolver created
+with SensitiveResolver. Use IsSensitive to check a property before logging
+its value.
+
+Programs running as root, or installed setuid, should not trust configuration
+that another user can change. Setting FilePermissions to FilePermissionsWarn
+or FilePermissionsReject checks that configuration files and their
+directories are not writable by group or others and are owned by an expected
+user, and that files holding sensitive properties are not readable by group
+or others. The same checks apply to files in secret directories and to
+files named by <VAR>_FILE environment variables.
+
+Regulated deployments can require configuration files to be signed by a
+release pipeline. With SignaturePolicy set and TrustedKeys listing the
+ed25519 or minisign public keys of the pipeline, each file must be
+accompanied by a detached signature, such as app.conf.sig for app.conf,
+which is verified before the file is parsed.
+
+Properties that must not change at runtime, such as security settings or
+values pinned on the command line, can be locked using LockedKeys,
+LockCommandLineArguments, or the Lock method of a Config. Set returns an error
+for a locked property, and a locked property is never read from the
+configuration store. Calling Freeze after startup locks every property, and
+stops values being read from the configuration store. Locking only governs
+changes made through the Config: writes made directly to the configuration
+store are checked as well if it is wrapped using NewLockedFlexConfigStore.
+
+When a value is not what was expected, Explain reports where it came from:
+the file and line, environment variable, command line argument, secret file,
+configuration store, or call to Set or Load that defined it, followed by the
+lower priority values it overrides.
+
+Export writes the effective configuration as YAML, JSON, INI, key=value
+properties, or shell environment variable assignments, optionally redacting
+sensitive values, for support bundles or for configuring other tools. In YAML
+and JSON, keys are nested so that a property such as a.b.0.c is written as
+the structure it would have been read from. Values read from a secret source
+are redacted even when redaction is not requested.
+
+Diff compares two configurations, such as staging and production, reporting
+the properties added, removed, or changed along with the source of each
+value, and WriteDiff renders the changes as text for review or logging.
+
+Snapshot returns an immutable view of the configuration, including the
+values in the configuration store, at one instant. Reading every property a
+request needs from one snapshot avoids seeing a partly applied set of updates
+to the store. Restore undoes changes made by Set and Load since a snapshot
+was taken.
+
+A misspelled key, such as databse.host, is otherwise silently ignored.
+Listing the keys the application uses in KnownKeys reports every other
+property read as a warning naming its source and the nearest known key, and
+StrictKeys makes NewFlexibleConfiguration fail instead.
+
+Keys can be renamed across a fleet using KeyAliases, which maps each
+deprecated key to the key replacing it. Until every source has been updated,
+reading the new key falls back to the deprecated key, in any source including
+the configuration store, and a warning naming where the deprecated key was
+set is reported once. The new key wins when both are set.
+
+Applications can document each property they use with a KeyDoc giving its
+description, type, default, and example. WriteReference generates a reference
+of the documented properties as Markdown, a man page, or plain text for help
+output, so operators need not search the source for the keys that exist.
+The default given in a KeyDoc is only documented; it does not give the
+property a value.
+
+A configuration store implementing FlexConfigStoreWatcher, as the etcd store
+does, reports changes to a property and the properties below it as they are
+made. The flexconfig command in cmd/flexconfig uses the same key translation
+as the store to get, set, delete, list, and watch properties in etcd, so
+log.filepath is used directly rather than /example/log/filepath.
+
+ImportStoreFile seeds a configuration store from a YAML, JSON, or INI file,
+such as one kept under version control, and ExportStoreFile writes the
+properties in a store back out as a nested file. Both return the changes, and
+with DryRun make none, so the changes can be reviewed with WriteDiff first.
+
+PlanStore compares a configuration store with a desired state kept in a file
+or a directory of files, returning the properties to add, update, and, with
+Prune, delete. Applying the plan makes the changes in a single transaction if
+the store implements FlexConfigStoreBatcher, as the etcd store does, and
+fails with ErrStoreChanged if the store was changed after the plan was made.
+The policy, audited, encrypted, and locked stores wrapping a batching store
+pass the changes on to it in a single batch. A directory of files includes
+those with the suffix ".conf", whose format is detected from their contents.
+
+The Config returned by NewFlexibleConfiguration only reads and sets
+properties. The other features of the configuration, such as Load, Lock,
+Explain, Export, and Snapshot, are methods of ExtendedConfig, obtained by a
+type assertion, so that other implementations of Config are not required to
+provide them:
+    ext := cfg.(flexconfig.ExtendedConfig)
+    err = ext.Load(r, flexconfig.ConfigurationFormatYAML)
+
 Accessing the configuration to obtain property values will consult the
 configuration store first, if it has been configured. If this results in an
 error or an empty value, the in-memory configuration read from files, env vars,
 and the command line, is consulted.
+
+Values in a configuration store are visible to anyone able to read the store.
+Wrapping a store with NewEncryptedFlexConfigStore encrypts each value under
+its own data key, which is in turn encrypted under a StoreKey. Values remain
+readable after the StoreKey is replaced, as long as the previous key is
+provided, and Rotate re-encrypts them under the current key.
+
+When several teams share a configuration store, NewPolicyFlexConfigStore
+restricts the properties a process may write according to WriteRules matching
+its identity, and a denied write returns a *WriteDeniedError. Stores created
+with NewAuthenticatedFlexConfigStore authenticate to etcd, so that the roles
+granted to the user are enforced by etcd itself.
+
+Changes to a configuration can be recorded for later review by setting an
+AuditSink, such as one returned by NewFileAuditSink, which writes each change
+as a line of JSON. Every Set and Load produces an AuditEvent naming the key,
+its old and new values, the identity making the change, and the layer
+changed, with sensitive values redacted. NewAuditedFlexConfigStore records
+changes made directly to a configuration store in the same way.
 */
 package flexconfig
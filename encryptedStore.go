@@ -0,0 +1,315 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	envelopeScheme         = "envelope"
+	envelopeFieldSeparator = ","
+)
+
+var (
+	// ErrStoreKeyNotValid indicates a StoreKey has no ID, an ID
+	// containing a comma, or a key that is not 32 bytes long.
+	ErrStoreKeyNotValid = errors.New("Store encryption key not valid")
+
+	// ErrStoreKeyUnknown indicates a value in the store was encrypted
+	// using a key that was not provided to the EncryptedFlexConfigStore.
+	ErrStoreKeyUnknown = errors.New("Store encryption key unknown")
+)
+
+// StoreKey is a 32 byte key used by an EncryptedFlexConfigStore to encrypt
+// the data keys protecting property values. The ID is stored with each value,
+// so that the key used to encrypt it can be found after the key is rotated.
+type StoreKey struct {
+	ID  string
+	Key []byte
+}
+
+// EncryptedFlexConfigStore is a FlexConfigStore that encrypts property values
+// before writing them to another FlexConfigStore, and decrypts them when they
+// are read. Each value is encrypted with AES-256-GCM under a new random data
+// key, and the data key is encrypted under the current StoreKey. Values are
+// stored in the form
+//
+//	ENC[envelope,<key ID>,<encrypted data key>,<encrypted value>]
+//
+// and are bound to their property keys, so a value copied to another key
+// cannot be decrypted. Values in the underlying store that are not encrypted
+// are returned unchanged, allowing an existing store to be migrated.
+type EncryptedFlexConfigStore struct {
+	store   FlexConfigStore
+	current StoreKey
+	keys    map[string][]byte
+}
+
+// NewEncryptedFlexConfigStore returns a FlexConfigStore encrypting values
+// written to store using the current key. Values encrypted using previous
+// keys can still be read; call Rotate to encrypt them using the current key.
+func NewEncryptedFlexConfigStore(
+	store FlexConfigStore,
+	current StoreKey,
+	previous ...StoreKey) (*EncryptedFlexConfigStore, error) {
+	keys := make(map[string][]byte)
+	for _, k := range append([]StoreKey{current}, previous...) {
+		if len(k.ID) == 0 ||
+			strings.Contains(k.ID, envelopeFieldSeparator) ||
+			len(k.Key) != aesKeySize {
+			return nil, ErrStoreKeyNotValid
+		}
+
+		keys[k.ID] = k.Key
+	}
+
+	efcs := new(EncryptedFlexConfigStore)
+	efcs.store = store
+	efcs.current = current
+	efcs.keys = keys
+
+	return efcs, nil
+}
+
+// Get returns the decrypted value of a property from the underlying store.
+func (efcs *EncryptedFlexConfigStore) Get(key string) (string, error) {
+	val, err := efcs.store.Get(key)
+	if err != nil || len(val) == 0 {
+		return val, err
+	}
+
+	return efcs.decrypt(key, val)
+}
+
+// GetAll returns all properties in the underlying store with their values
+// decrypted. An error naming the property is returned if any value cannot be
+// decrypted.
+func (efcs *EncryptedFlexConfigStore) GetAll() ([]KeyValue, error) {
+	kvs, err := efcs.store.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		val, err := efcs.decrypt(kv.Key, kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt property %s: %w",
+				kv.Key, err)
+		}
+
+		result = append(result, KeyValue{Key: kv.Key, Value: val})
+	}
+
+	return result, nil
+}
+
+// Set encrypts the value using the current key and writes it to the
+// underlying store.
+func (efcs *EncryptedFlexConfigStore) Set(key, val string) error {
+	if len(key) == 0 {
+		return ErrStoreKeyRequired
+	}
+
+	encrypted, err := efcs.encrypt(key, val)
+	if err != nil {
+		return err
+	}
+
+	return efcs.store.Set(key, encrypted)
+}
+
+// Delete removes a property from the underlying store.
+func (efcs *EncryptedFlexConfigStore) Delete(key string) error {
+	return efcs.store.Delete(key)
+}
+
+// ApplyBatch encrypts the values in the batch using the current key and
+// applies it to the underlying store. Since each encryption of a value is
+// different, the values expected are compared with the decrypted values in
+// the underlying store, which must then still hold the same encrypted values
+// for the batch to be applied. The batch is applied atomically only if the
+// underlying store implements FlexConfigStoreBatcher; otherwise each change
+// is made by Set or Delete.
+func (efcs *EncryptedFlexConfigStore) ApplyBatch(
+	expected, desired map[string]string) error {
+	batcher, ok := efcs.store.(FlexConfigStoreBatcher)
+	if !ok {
+		return applyChanges(efcs, expected, desired)
+	}
+
+	stored := make(map[string]string)
+	for k, v := range expected {
+		val, err := efcs.store.Get(k)
+		if err != nil {
+			return err
+		}
+
+		stored[k] = val
+		if len(val) > 0 {
+			val, err = efcs.decrypt(k, val)
+			if err != nil {
+				return fmt.Errorf("Unable to decrypt property %s: %w", k, err)
+			}
+		}
+
+		if val != v {
+			return fmt.Errorf("%w: %s", ErrStoreChanged, k)
+		}
+	}
+
+	encrypted := make(map[string]string)
+	for k, v := range desired {
+		if len(k) == 0 {
+			return ErrStoreKeyRequired
+		}
+
+		if len(v) > 0 {
+			var err error
+			v, err = efcs.encrypt(k, v)
+			if err != nil {
+				return err
+			}
+		}
+
+		encrypted[k] = v
+	}
+
+	return batcher.ApplyBatch(stored, encrypted)
+}
+
+// GetPrefix returns the prefix of the underlying store.
+func (efcs *EncryptedFlexConfigStore) GetPrefix() string {
+	return efcs.store.GetPrefix()
+}
+
+// Rotate encrypts every value in the underlying store that is not encrypted
+// using the current key, including values that are not encrypted at all.
+// Once Rotate succeeds, previous keys are no longer needed.
+func (efcs *EncryptedFlexConfigStore) Rotate() error {
+	kvs, err := efcs.store.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range kvs {
+		keyID, ok := envelopeKeyID(kv.Value)
+		if ok && keyID == efcs.current.ID {
+			continue
+		}
+
+		val, err := efcs.decrypt(kv.Key, kv.Value)
+		if err != nil {
+			return fmt.Errorf("Unable to decrypt property %s: %w",
+				kv.Key, err)
+		}
+
+		err = efcs.Set(kv.Key, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encrypt returns the envelope holding the value of the property.
+func (efcs *EncryptedFlexConfigStore) encrypt(key, val string) (string, error) {
+	dataKey := make([]byte, aesKeySize)
+	_, err := io.ReadFull(rand.Reader, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := sealAESGCM(dataKey, []byte(val),
+		[]byte(strings.TrimSpace(key)))
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := sealAESGCM(efcs.current.Key, dataKey,
+		[]byte(efcs.current.ID))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedValuePrefix + strings.Join([]string{
+		envelopeScheme,
+		efcs.current.ID,
+		base64.StdEncoding.EncodeToString(wrappedKey),
+		base64.StdEncoding.EncodeToString(ciphertext),
+	}, envelopeFieldSeparator) + encryptedValueSuffix, nil
+}
+
+// decrypt returns the value held in the envelope, or the value itself if it
+// is not an envelope.
+func (efcs *EncryptedFlexConfigStore) decrypt(key, val string) (string, error) {
+	scheme, data, ok := parseEncryptedValue(val)
+	if !ok || scheme != envelopeScheme {
+		return val, nil
+	}
+
+	fields := strings.Split(data, envelopeFieldSeparator)
+	if len(fields) != 3 {
+		return "", ErrEncryptedValueNotValid
+	}
+
+	kek, exists := efcs.keys[fields[0]]
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrStoreKeyUnknown, fields[0])
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", ErrEncryptedValueNotValid
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return "", ErrEncryptedValueNotValid
+	}
+
+	dataKey, err := openAESGCM(kek, wrappedKey, []byte(fields[0]))
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := openAESGCM(dataKey, ciphertext,
+		[]byte(strings.TrimSpace(key)))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// envelopeKeyID returns the ID of the key used to encrypt an envelope. The
+// returned bool is false if the value is not an envelope.
+func envelopeKeyID(val string) (string, bool) {
+	scheme, data, ok := parseEncryptedValue(val)
+	if !ok || scheme != envelopeScheme {
+		return "", false
+	}
+
+	return strings.SplitN(data, envelopeFieldSeparator, 2)[0], true
+}
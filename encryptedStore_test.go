@@ -0,0 +1,186 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_encryptedStore_setGet(t *testing.T) {
+	backing := newMemStore("/test")
+	key := StoreKey{ID: "k1", Key: bytes.Repeat([]byte{1}, 32)}
+
+	store, err := NewEncryptedFlexConfigStore(backing, key)
+	if err != nil {
+		t.Errorf("Unexpected error creating store: %v", err)
+		return
+	}
+
+	err = store.Set("db.password", "s3cret")
+	if err != nil {
+		t.Errorf("Unexpected error setting property: %v", err)
+	}
+
+	stored := backing.kvs["db.password"]
+	if !strings.HasPrefix(stored, "ENC[envelope,k1,") ||
+		strings.Contains(stored, "s3cret") {
+		t.Errorf("Expected encrypted value in store, found '%s'", stored)
+	}
+
+	val, err := store.Get("db.password")
+	if err != nil || val != "s3cret" {
+		t.Errorf("Expected 's3cret', found '%s' (%v)", val, err)
+	}
+
+	// A value written before the store was encrypted is returned as is
+	backing.kvs["plain"] = "text"
+	kvs, err := store.GetAll()
+	if err != nil || len(kvs) != 2 {
+		t.Errorf("Unexpected result from GetAll: %v (%v)", kvs, err)
+	}
+
+	for _, kv := range kvs {
+		if (kv.Key == "db.password" && kv.Value != "s3cret") ||
+			(kv.Key == "plain" && kv.Value != "text") {
+			t.Errorf("Unexpected value for %s: '%s'", kv.Key, kv.Value)
+		}
+	}
+
+	// An encrypted value copied to another property is not decrypted
+	backing.kvs["other"] = stored
+	_, err = store.Get("other")
+	if !errors.Is(err, ErrEncryptedValueNotValid) {
+		t.Errorf("Expected ErrEncryptedValueNotValid, found %v", err)
+	}
+
+	if store.GetPrefix() != "/test" {
+		t.Errorf("Expected prefix of underlying store")
+	}
+
+	store.Delete("db.password")
+	if _, exists := backing.kvs["db.password"]; exists {
+		t.Errorf("Expected property to be deleted from underlying store")
+	}
+
+	if store.Set("", "x") != ErrStoreKeyRequired {
+		t.Errorf("Expected ErrStoreKeyRequired")
+	}
+}
+
+func Test_encryptedStore_rotate(t *testing.T) {
+	backing := newMemStore("")
+	oldKey := StoreKey{ID: "old", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := StoreKey{ID: "new", Key: bytes.Repeat([]byte{2}, 32)}
+
+	oldStore, _ := NewEncryptedFlexConfigStore(backing, oldKey)
+	oldStore.Set("a.b", "one")
+	backing.kvs["c.d"] = "two"
+
+	// Without the old key, the value cannot be read
+	newOnly, _ := NewEncryptedFlexConfigStore(backing, newKey)
+	_, err := newOnly.Get("a.b")
+	if !errors.Is(err, ErrStoreKeyUnknown) {
+		t.Errorf("Expected ErrStoreKeyUnknown, found %v", err)
+	}
+
+	_, err = newOnly.GetAll()
+	if !errors.Is(err, ErrStoreKeyUnknown) ||
+		!strings.Contains(err.Error(), "a.b") {
+		t.Errorf("Expected error naming a.b, found %v", err)
+	}
+
+	rotating, err := NewEncryptedFlexConfigStore(backing, newKey, oldKey)
+	if err != nil {
+		t.Errorf("Unexpected error creating store: %v", err)
+		return
+	}
+
+	val, err := rotating.Get("a.b")
+	if err != nil || val != "one" {
+		t.Errorf("Expected old value to be readable, found '%s' (%v)",
+			val, err)
+	}
+
+	err = rotating.Rotate()
+	if err != nil {
+		t.Errorf("Unexpected error rotating: %v", err)
+	}
+
+	for k, e := range map[string]string{"a.b": "one", "c.d": "two"} {
+		keyID, ok := envelopeKeyID(backing.kvs[k])
+		if !ok || keyID != "new" {
+			t.Errorf("Expected %s encrypted with new key, found '%s'",
+				k, backing.kvs[k])
+		}
+
+		val, err := newOnly.Get(k)
+		if err != nil || val != e {
+			t.Errorf("Expected '%s' for %s, found '%s' (%v)", e, k, val, err)
+		}
+	}
+}
+
+func Test_encryptedStore_badKeys(t *testing.T) {
+	backing := newMemStore("")
+	good := StoreKey{ID: "good", Key: bytes.Repeat([]byte{1}, 32)}
+
+	bad := []StoreKey{
+		{ID: "", Key: good.Key},
+		{ID: "a,b", Key: good.Key},
+		{ID: "short", Key: []byte("too short")},
+	}
+
+	for _, k := range bad {
+		_, err := NewEncryptedFlexConfigStore(backing, k)
+		if err != ErrStoreKeyNotValid {
+			t.Errorf("Expected ErrStoreKeyNotValid for %q, found %v",
+				k.ID, err)
+		}
+
+		_, err = NewEncryptedFlexConfigStore(backing, good, k)
+		if err != ErrStoreKeyNotValid {
+			t.Errorf("Expected ErrStoreKeyNotValid for previous %q, "+
+				"found %v", k.ID, err)
+		}
+	}
+}
+
+func Test_encryptedStore_configuration(t *testing.T) {
+	backing := newMemStore("")
+	key := StoreKey{ID: "k1", Key: bytes.Repeat([]byte{3}, 32)}
+	store, _ := NewEncryptedFlexConfigStore(backing, key)
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ConfigurationStore: store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("api.token", "abc123")
+	if strings.Contains(backing.kvs["api.token"], "abc123") {
+		t.Errorf("Expected value to be encrypted in the store")
+	}
+
+	if cfg.Get("api.token") != "abc123" {
+		t.Errorf("Expected 'abc123', found '%s'", cfg.Get("api.token"))
+	}
+}
@@ -0,0 +1,281 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	encryptedValuePrefix           = "ENC["
+	encryptedValueSuffix           = "]"
+	encryptionSchemeAESGCM         = "aes256gcm"
+	aesKeySize                     = 32
+	flexConfigEnvDecryptionKey     = "FLEXCONFIG_DECRYPTION_KEY"
+	flexConfigEnvDecryptionKeyFile = "FLEXCONFIG_DECRYPTION_KEY_FILE"
+)
+
+var (
+	// ErrDecryptionKeyRequired indicates a property value is encrypted
+	// using a scheme for which no key or Decrypter was provided.
+	ErrDecryptionKeyRequired = errors.New("Decryption key required")
+
+	// ErrDecryptionKeyNotValid indicates a decryption key does not have
+	// the size required by the encryption scheme.
+	ErrDecryptionKeyNotValid = errors.New("Decryption key not valid")
+
+	// ErrEncryptedValueNotValid indicates an encrypted property value is
+	// malformed or could not be decrypted with the provided key.
+	ErrEncryptedValueNotValid = errors.New("Encrypted value not valid")
+)
+
+// Decrypter decrypts property values encrypted using a single scheme. A
+// property value of the form ENC[<scheme>,<data>] is decrypted by passing
+// <data> to the Decrypter registered for <scheme>.
+type Decrypter interface {
+	// Decrypt returns the plaintext for the encrypted data.
+	Decrypt(data string) (string, error)
+}
+
+// aesGCMDecrypter is the Decrypter for the built in "aes256gcm" scheme.
+type aesGCMDecrypter struct {
+	key []byte
+}
+
+// NewAESGCMDecrypter returns a Decrypter for values encrypted by EncryptValue
+// using the scheme "aes256gcm". The key must be 32 bytes long.
+func NewAESGCMDecrypter(key []byte) (Decrypter, error) {
+	if len(key) != aesKeySize {
+		return nil, ErrDecryptionKeyNotValid
+	}
+
+	return &aesGCMDecrypter{key: key}, nil
+}
+
+// Decrypt returns the plaintext of base64 encoded data consisting of a nonce
+// followed by AES-256-GCM ciphertext.
+func (d *aesGCMDecrypter) Decrypt(data string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", ErrEncryptedValueNotValid
+	}
+
+	plaintext, err := openAESGCM(d.key, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptValue encrypts a property value with AES-256-GCM using the
+// specified 32 byte key. The result has the form ENC[aes256gcm,<data>] and
+// can be placed in a YAML, JSON, or INI configuration file in place of the
+// plaintext value.
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	if len(key) != aesKeySize {
+		return "", ErrDecryptionKeyNotValid
+	}
+
+	sealed, err := sealAESGCM(key, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedValuePrefix + encryptionSchemeAESGCM + "," +
+		base64.StdEncoding.EncodeToString(sealed) +
+		encryptedValueSuffix, nil
+}
+
+// sealAESGCM encrypts plaintext with AES-GCM, returning a random nonce
+// followed by the ciphertext. The additional data, which may be nil, is
+// authenticated but not encrypted, and must be supplied again to open the
+// ciphertext.
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// openAESGCM decrypts data produced by sealAESGCM.
+func openAESGCM(key, sealed, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrEncryptedValueNotValid
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():],
+		additionalData)
+	if err != nil {
+		return nil, ErrEncryptedValueNotValid
+	}
+
+	return plaintext, nil
+}
+
+// parseEncryptedValue splits a value of the form ENC[<scheme>,<data>] into
+// its scheme and data. The returned bool is false if the value does not
+// have that form.
+func parseEncryptedValue(val string) (string, string, bool) {
+	v := strings.TrimSpace(val)
+	if !strings.HasPrefix(v, encryptedValuePrefix) ||
+		!strings.HasSuffix(v, encryptedValueSuffix) {
+		return "", "", false
+	}
+
+	v = v[len(encryptedValuePrefix) : len(v)-len(encryptedValueSuffix)]
+	index := strings.Index(v, ",")
+	if index <= 0 {
+		return "", "", false
+	}
+
+	return v[:index], v[index+1:], true
+}
+
+// newDecrypters returns the Decrypters used for a configuration, keyed by
+// scheme. The Decrypters in the ConfigurationParameters are included, and a
+// Decrypter for the built in scheme is added when a key is available from
+// the key file in the parameters, the file named by the environment variable
+// FLEXCONFIG_DECRYPTION_KEY_FILE, or the base64 encoded key in the
+// environment variable FLEXCONFIG_DECRYPTION_KEY.
+func newDecrypters(
+	keyFile string,
+	decrypters map[string]Decrypter) (map[string]Decrypter, error) {
+	result := make(map[string]Decrypter)
+	for scheme, d := range decrypters {
+		result[scheme] = d
+	}
+
+	if _, exists := result[encryptionSchemeAESGCM]; exists {
+		return result, nil
+	}
+
+	key, err := loadDecryptionKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		d, err := NewAESGCMDecrypter(key)
+		if err != nil {
+			return nil, err
+		}
+
+		result[encryptionSchemeAESGCM] = d
+	}
+
+	return result, nil
+}
+
+// loadDecryptionKey returns the key for the built in encryption scheme, or
+// nil if no key has been provided. A key file holds the base64 encoding of
+// the key.
+func loadDecryptionKey(keyFile string) ([]byte, error) {
+	if len(keyFile) == 0 {
+		keyFile = os.Getenv(flexConfigEnvDecryptionKeyFile)
+	}
+
+	encoded := ""
+	if len(keyFile) > 0 {
+		contents, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read decryption key: %w", err)
+		}
+
+		encoded = string(contents)
+	} else {
+		encoded = os.Getenv(flexConfigEnvDecryptionKey)
+	}
+
+	encoded = strings.TrimSpace(encoded)
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != aesKeySize {
+		return nil, ErrDecryptionKeyNotValid
+	}
+
+	return key, nil
+}
+
+// decryptValues replaces every encrypted property value with its plaintext.
+// The keys of the decrypted properties are returned so they can be treated
+// as sensitive. An error naming the property is returned if a value cannot
+// be decrypted, so that a ciphertext is never used as a property value.
+func decryptValues(
+	vars map[string]string,
+	decrypters map[string]Decrypter) (map[string]bool, error) {
+	decrypted := make(map[string]bool)
+	for key, val := range vars {
+		scheme, data, ok := parseEncryptedValue(val)
+		if !ok {
+			continue
+		}
+
+		d := decrypters[scheme]
+		if d == nil {
+			return nil, fmt.Errorf("Unable to decrypt property %s: %w",
+				key, ErrDecryptionKeyRequired)
+		}
+
+		plaintext, err := d.Decrypt(data)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt property %s: %w",
+				key, err)
+		}
+
+		vars[key] = plaintext
+		decrypted[key] = true
+	}
+
+	return decrypted, nil
+}
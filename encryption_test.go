@@ -0,0 +1,189 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, 32)
+
+type reverseDecrypter struct{}
+
+func (d reverseDecrypter) Decrypt(data string) (string, error) {
+	r := []rune(data)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+
+	return string(r), nil
+}
+
+func Test_encryption_roundTrip(t *testing.T) {
+	enc, err := EncryptValue(testEncryptionKey, "s3cr3t")
+	if err != nil {
+		t.Errorf("Unexpected error encrypting: %v", err)
+		return
+	}
+
+	if !strings.HasPrefix(enc, "ENC[aes256gcm,") || strings.Contains(enc, "s3cr3t") {
+		t.Errorf("Unexpected encrypted value: %s", enc)
+	}
+
+	d, err := NewAESGCMDecrypter(testEncryptionKey)
+	if err != nil {
+		t.Errorf("Unexpected error creating decrypter: %v", err)
+		return
+	}
+
+	vars := map[string]string{"db.password": enc, "db.user": "app"}
+	decrypted, err := decryptValues(vars,
+		map[string]Decrypter{encryptionSchemeAESGCM: d})
+	if err != nil {
+		t.Errorf("Unexpected error decrypting: %v", err)
+	}
+
+	if vars["db.password"] != "s3cr3t" || vars["db.user"] != "app" {
+		t.Errorf("Unexpected properties: %v", vars)
+	}
+
+	if !decrypted["db.password"] || decrypted["db.user"] {
+		t.Errorf("Unexpected decrypted keys: %v", decrypted)
+	}
+}
+
+func Test_encryption_missingKey(t *testing.T) {
+	enc, _ := EncryptValue(testEncryptionKey, "s3cr3t")
+	vars := map[string]string{"db.password": enc}
+
+	_, err := decryptValues(vars, map[string]Decrypter{})
+	if !errors.Is(err, ErrDecryptionKeyRequired) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err != nil && !strings.Contains(err.Error(), "db.password") {
+		t.Errorf("Error does not name property: %v", err)
+	}
+}
+
+func Test_encryption_wrongKey(t *testing.T) {
+	enc, _ := EncryptValue(testEncryptionKey, "s3cr3t")
+	vars := map[string]string{"db.password": enc}
+
+	d, _ := NewAESGCMDecrypter(bytes.Repeat([]byte{0x24}, 32))
+	_, err := decryptValues(vars,
+		map[string]Decrypter{encryptionSchemeAESGCM: d})
+	if !errors.Is(err, ErrEncryptedValueNotValid) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_encryption_parse(t *testing.T) {
+	scheme, data, ok := parseEncryptedValue("ENC[age,abc,def]")
+	if !ok || scheme != "age" || data != "abc,def" {
+		t.Errorf("Unexpected parse: %s %s %v", scheme, data, ok)
+	}
+
+	for _, v := range []string{"plain", "ENC[]", "ENC[age]", "ENC[,abc]", "ENC[age,abc"} {
+		_, _, ok = parseEncryptedValue(v)
+		if ok {
+			t.Errorf("Unexpected parse of %s", v)
+		}
+	}
+}
+
+func Test_encryption_keyFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigKey")
+	if err != nil {
+		t.Errorf("Can't create temporary file")
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString(base64.StdEncoding.EncodeToString(testEncryptionKey) + "\n")
+	f.Close()
+
+	key, err := loadDecryptionKey(f.Name())
+	if err != nil || !bytes.Equal(key, testEncryptionKey) {
+		t.Errorf("Unexpected key: %v %v", key, err)
+	}
+
+	_, err = loadDecryptionKey(f.Name() + ".missing")
+	if err == nil {
+		t.Errorf("Unexpected success reading missing key file")
+	}
+
+	os.Setenv(flexConfigEnvDecryptionKey, "bm90IGEga2V5")
+	_, err = loadDecryptionKey("")
+	if err != ErrDecryptionKeyNotValid {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	os.Unsetenv(flexConfigEnvDecryptionKey)
+}
+
+func Test_encryption_configuration(t *testing.T) {
+	enc, _ := EncryptValue(testEncryptionKey, "s3cr3t")
+	fsys := fstest.MapFS{
+		"etc/encApp/app.conf": {Data: []byte("db:\n  password: " + enc +
+			"\n  token: ENC[rev,nekot]\n")},
+	}
+
+	os.Args = []string{}
+	_, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "encApp",
+		FileSystem:      fsys,
+	})
+	if !errors.Is(err, ErrDecryptionKeyRequired) {
+		t.Errorf("Unexpected error without key: %v", err)
+	}
+
+	os.Setenv(flexConfigEnvDecryptionKey,
+		base64.StdEncoding.EncodeToString(testEncryptionKey))
+	defer os.Unsetenv(flexConfigEnvDecryptionKey)
+
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "encApp",
+		FileSystem:      fsys,
+		Decrypters:      map[string]Decrypter{"rev": reverseDecrypter{}},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if c.Get("db.password") != "s3cr3t" {
+		t.Errorf("Unexpected value: %s", c.Get("db.password"))
+	}
+
+	if c.Get("db.token") != "token" {
+		t.Errorf("Unexpected value: %s", c.Get("db.token"))
+	}
+
+	fc := c.(*flexibleConfiguration)
+	if !fc.sensitive["db.password"] || !fc.sensitive["db.token"] {
+		t.Errorf("Decrypted properties not sensitive: %v", fc.sensitive)
+	}
+}
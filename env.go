@@ -17,33 +17,137 @@ limitations under the License.
 */
 
 import (
-	"os"
+	"io/ioutil"
 	"strings"
 )
 
-// readEnvVars iterates through all environment variables, selecting those with
-// the one of the specified prefixes, and adds properties having a name
+const (
+	envFileSuffix = "_FILE"
+)
+
+// readEnvVars iterates through the environment variables, selecting those
+// with the one of the specified prefixes, and adds properties having a name
 // converted to canonical format, and a value of the environment variable.
-func readEnvVars(vars map[string]string, prefixes []string) {
-	envs := os.Environ()
+// The name of the variable from which each property was set is recorded in
+// names.
+//
+// If fileVars is true, environment variables whose name ends in "_FILE" name
+// a file containing the value, and are evaluated first, so that a variable
+// setting a value directly overrides a variable naming a file containing the
+// value. Otherwise they are evaluated like any other variable. A file
+// rejected by the permission check is not read.
+func readEnvVars(
+	vars, names map[string]string,
+	envs, prefixes []string,
+	fileVars bool,
+	permissions *permissionCheck) {
+	if fileVars {
+		for _, e := range envs {
+			if isFileEnvVar(e) {
+				evaluateFileEnvVar(vars, names, prefixes, e, permissions)
+			}
+		}
+	}
+
 	for _, e := range envs {
-		evaluateEnvVar(vars, prefixes, e)
+		if !fileVars || !isFileEnvVar(e) {
+			evaluateEnvVar(vars, names, prefixes, e)
+		}
 	}
 }
 
 // evaluateEnvVar checks a single environment variable against accepted
 // prefixes to decide if a configuramtion property should be added.
-func evaluateEnvVar(vars map[string]string, prefixes []string, envvar string) {
+func evaluateEnvVar(
+	vars, names map[string]string,
+	prefixes []string,
+	envvar string) {
 	pair := strings.Split(envvar, "=")
 	for _, prefix := range prefixes {
 		if strings.HasPrefix(pair[0], prefix) {
 			key := transformEnvName(pair[0])
 			vars[key] = pair[1]
+			names[key] = pair[0]
+			break
+		}
+	}
+}
+
+// evaluateFileEnvVar reads the file named by the value of an environment
+// variable following the <VAR>_FILE convention, if it has one of the
+// accepted prefixes, and sets the property named after <VAR> to the contents
+// of the file. A file that cannot be read, or is rejected by the permission
+// check, is ignored. The file is treated as holding sensitive properties if
+// the key matches the sensitive key patterns.
+func evaluateFileEnvVar(
+	vars, names map[string]string,
+	prefixes []string,
+	envvar string,
+	permissions *permissionCheck) {
+	pair := strings.Split(envvar, "=")
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(pair[0], prefix) {
+			key := transformEnvName(strings.TrimSuffix(pair[0],
+				envFileSuffix))
+			if !permissions.allow(pair[1], permissions.isSensitiveKey(key)) {
+				return
+			}
+
+			val, err := readSecretFile(pair[1])
+			if err != nil {
+				return
+			}
+
+			vars[key] = val
+			names[key] = pair[0]
 			break
 		}
 	}
 }
 
+// fileEnvVarKeys returns the keys of the properties defined by environment
+// variables, having one of the specified prefixes, that follow the
+// <VAR>_FILE convention.
+func fileEnvVarKeys(envs, prefixes []string) []string {
+	var keys []string
+	for _, e := range envs {
+		if !isFileEnvVar(e) {
+			continue
+		}
+
+		name := strings.Split(e, "=")[0]
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				keys = append(keys, transformEnvName(
+					strings.TrimSuffix(name, envFileSuffix)))
+				break
+			}
+		}
+	}
+
+	return keys
+}
+
+// isFileEnvVar returns whether the name of the environment variable follows
+// the <VAR>_FILE convention, where the value is the path of a file holding
+// the value for <VAR>.
+func isFileEnvVar(envvar string) bool {
+	name := strings.Split(envvar, "=")[0]
+	return len(name) > len(envFileSuffix) &&
+		strings.HasSuffix(name, envFileSuffix)
+}
+
+// readSecretFile returns the contents of a file holding a single value, such
+// as a password. Trailing line endings are removed from the value.
+func readSecretFile(filename string) (string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
 // transformEnvName converts an environment variable name into the canonical
 // configuration proeprty key form.
 func transformEnvName(envName string) string {
@@ -17,13 +17,15 @@ limitations under the License.
 */
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 )
 
 func Test_env_emptyPrefixList(t *testing.T) {
 	v := make(map[string]string)
-	readEnvVars(v, nil)
+	readEnvVars(v, make(map[string]string), os.Environ(),
+		nil, false, nil)
 
 	if len(v) > 0 {
 		t.Errorf("Unexpected properties found")
@@ -35,7 +37,8 @@ func Test_env(t *testing.T) {
 	os.Setenv("TEST_CONFIG_ENV_TWO", "42")
 
 	v := make(map[string]string)
-	readEnvVars(v, []string{"TEST_CONFIG_ENV_"})
+	readEnvVars(v, make(map[string]string), os.Environ(),
+		[]string{"TEST_CONFIG_ENV_"}, false, nil)
 
 	if len(v) != 2 {
 		t.Errorf("Unexpected properties found")
@@ -58,7 +61,8 @@ func Test_env_someAccepted(t *testing.T) {
 	os.Setenv("DEBUG_CONFIG_ENV_TWO", "42")
 
 	v := make(map[string]string)
-	readEnvVars(v, []string{"TEST_CONFIG_ENV_"})
+	readEnvVars(v, make(map[string]string), os.Environ(),
+		[]string{"TEST_CONFIG_ENV_"}, false, nil)
 
 	if len(v) != 1 {
 		t.Errorf("Unexpected properties found")
@@ -74,7 +78,7 @@ func Test_env_someAccepted(t *testing.T) {
 
 func Test_evaluate_nilPrefix(t *testing.T) {
 	v := make(map[string]string)
-	evaluateEnvVar(v, nil, "TEST_IT=42")
+	evaluateEnvVar(v, make(map[string]string), nil, "TEST_IT=42")
 
 	if len(v) > 0 {
 		t.Errorf("Unexpected properties found")
@@ -83,7 +87,7 @@ func Test_evaluate_nilPrefix(t *testing.T) {
 
 func Test_evaluate_emptyPrefix(t *testing.T) {
 	v := make(map[string]string)
-	evaluateEnvVar(v, []string{}, "TEST_IT=42")
+	evaluateEnvVar(v, make(map[string]string), []string{}, "TEST_IT=42")
 
 	if len(v) > 0 {
 		t.Errorf("Unexpected properties found")
@@ -92,7 +96,8 @@ func Test_evaluate_emptyPrefix(t *testing.T) {
 
 func Test_evaluate_otherPrefix(t *testing.T) {
 	v := make(map[string]string)
-	evaluateEnvVar(v, []string{"DEBUG_", "OTHER_", "TEST_CONFIG_"}, "TEST_IT=42")
+	evaluateEnvVar(v, make(map[string]string),
+		[]string{"DEBUG_", "OTHER_", "TEST_CONFIG_"}, "TEST_IT=42")
 
 	if len(v) > 0 {
 		t.Errorf("Unexpected properties found")
@@ -101,7 +106,8 @@ func Test_evaluate_otherPrefix(t *testing.T) {
 
 func Test_evaluate_found(t *testing.T) {
 	v := make(map[string]string)
-	evaluateEnvVar(v, []string{"DEBUG_", "OTHER_", "TEST_"}, "TEST_IT=42")
+	evaluateEnvVar(v, make(map[string]string),
+		[]string{"DEBUG_", "OTHER_", "TEST_"}, "TEST_IT=42")
 
 	if len(v) != 1 {
 		t.Errorf("Unexpected properties found")
@@ -111,3 +117,77 @@ func Test_evaluate_found(t *testing.T) {
 		t.Errorf("Unexpected value: %s", v["test.it"])
 	}
 }
+
+func Test_env_fileReference(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigSecret")
+	if err != nil {
+		t.Errorf("Can't create temporary file: %v", err)
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("s3cr3t\n")
+	f.Close()
+
+	os.Setenv("TEST_SECRET_DB_PASSWORD_FILE", f.Name())
+	os.Setenv("TEST_SECRET_DB_MISSING_FILE", f.Name()+".missing")
+
+	v := make(map[string]string)
+	readEnvVars(v, make(map[string]string), os.Environ(),
+		[]string{"TEST_SECRET_"}, true, nil)
+
+	if len(v) != 1 {
+		t.Errorf("Unexpected properties found: %v", v)
+	}
+
+	if v["test.secret.db.password"] != "s3cr3t" {
+		t.Errorf("Unexpected value: %s", v["test.secret.db.password"])
+	}
+
+	os.Setenv("TEST_SECRET_DB_PASSWORD", "direct")
+
+	v = make(map[string]string)
+	readEnvVars(v, make(map[string]string), os.Environ(),
+		[]string{"TEST_SECRET_"}, true, nil)
+
+	if v["test.secret.db.password"] != "direct" {
+		t.Errorf("Direct value did not override file: %s",
+			v["test.secret.db.password"])
+	}
+
+	os.Unsetenv("TEST_SECRET_DB_PASSWORD_FILE")
+	os.Unsetenv("TEST_SECRET_DB_MISSING_FILE")
+	os.Unsetenv("TEST_SECRET_DB_PASSWORD")
+}
+
+func Test_env_fileSuffixWithoutOptIn(t *testing.T) {
+	os.Setenv("PROBE_LOG_FILE", "/var/log/x.log")
+	defer os.Unsetenv("PROBE_LOG_FILE")
+
+	v := make(map[string]string)
+	names := make(map[string]string)
+	readEnvVars(v, names, os.Environ(), []string{"PROBE_"}, false, nil)
+
+	if len(v) != 1 || v["probe.log.file"] != "/var/log/x.log" {
+		t.Errorf("Expected probe.log.file to be set, found %v", v)
+	}
+
+	if names["probe.log.file"] != "PROBE_LOG_FILE" {
+		t.Errorf("Expected probe.log.file to come from PROBE_LOG_FILE")
+	}
+}
+
+func Test_isFileEnvVar(t *testing.T) {
+	if !isFileEnvVar("DB_PASSWORD_FILE=/run/secrets/db") {
+		t.Errorf("Expected file environment variable")
+	}
+
+	if isFileEnvVar("_FILE=/run/secrets/db") {
+		t.Errorf("Unexpected file environment variable")
+	}
+
+	if isFileEnvVar("DB_PASSWORD=/run/secrets/db_FILE") {
+		t.Errorf("Unexpected file environment variable")
+	}
+}
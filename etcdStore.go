@@ -23,6 +23,7 @@ import (
 	"time"
 
 	etcd "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
 	//etcd "github.com/coreos/etcd/clientv3"
 	//"golang.org/x/net/context"
 	"context"
@@ -35,8 +36,9 @@ const (
 // etcdStruct provides a handle for an instance of an etcd flexible
 // configuration store.
 type etcdStruct struct {
-	client *etcd.Client
-	prefix string
+	client   *etcd.Client
+	prefix   string
+	username string
 }
 
 // newEtcdFlexConfigStore creates a new FlexConfigStore with the specified
@@ -55,6 +57,19 @@ type etcdStruct struct {
 func newEtcdFlexConfigStore(
 	endpoints []string,
 	prefix string) (FlexConfigStore, error) {
+	return newAuthenticatedEtcdFlexConfigStore(endpoints, prefix,
+		StoreCredentials{})
+}
+
+// newAuthenticatedEtcdFlexConfigStore creates a new FlexConfigStore in the
+// same way as newEtcdFlexConfigStore, authenticating to etcd as the user in
+// the credentials. When etcd authentication is enabled, the roles granted to
+// the user determine which keys it may read and write, and a write denied by
+// etcd returns a *WriteDeniedError.
+func newAuthenticatedEtcdFlexConfigStore(
+	endpoints []string,
+	prefix string,
+	credentials StoreCredentials) (FlexConfigStore, error) {
 	// Create the configuration for etcd
 
 	err := validateEndpoints(endpoints)
@@ -66,6 +81,8 @@ func newEtcdFlexConfigStore(
 		Endpoints: endpoints,
 		DialTimeout: time.Duration(etcdRequestTimeoutMs) *
 			time.Millisecond,
+		Username: credentials.Username,
+		Password: credentials.Password,
 	}
 
 	client, err := etcd.New(etcdConfig)
@@ -88,6 +105,7 @@ func newEtcdFlexConfigStore(
 	fcs := new(etcdStruct)
 	fcs.client = client
 	fcs.prefix = prefix
+	fcs.username = credentials.Username
 
 	return fcs, nil
 }
@@ -148,20 +166,84 @@ func (fcs *etcdStruct) GetAll() ([]KeyValue, error) {
 	// stripped if a prefix was set when the store was created.
 	var result []KeyValue
 	for _, n := range resp.Kvs {
-		key := string(n.Key)
-		if strings.HasPrefix(key, prefix) {
-			key = key[len(prefix):]
+		result = append(result, KeyValue{Key: fcs.propertyKey(n.Key),
+			Value: string(n.Value)})
+	}
+
+	return result, nil
+}
+
+// Watch sends an event on the returned channel for every change to the
+// property with the specified key, or to a property below it, until the
+// context is done or etcd reports an error, when the channel is closed. An
+// error, or the end of the watch by etcd before the context is done, is
+// reported by a last event whose Err is set. If the key is empty, changes to
+// every property having the prefix of the store are sent.
+func (fcs *etcdStruct) Watch(
+	ctx context.Context,
+	key string) (<-chan WatchEvent, error) {
+	key = strings.TrimSpace(key)
+	target := fcs.prefix + "/"
+	if len(key) > 0 {
+		target = fcs.prefix + dotsToSlash(key)
+	}
+
+	responses := fcs.client.Watch(ctx, target, etcd.WithPrefix())
+	events := make(chan WatchEvent)
+
+	go func() {
+		defer close(events)
+
+		fail := func(err error) {
+			select {
+			case events <- WatchEvent{Err: err}:
+			case <-ctx.Done():
+			}
 		}
 
-		if strings.HasPrefix(key, "/") {
-			key = key[1:]
+		for resp := range responses {
+			if resp.Err() != nil {
+				fail(resp.Err())
+				return
+			}
+
+			for _, ev := range resp.Events {
+				// A watch of log also reports changes to logger
+				k := fcs.propertyKey(ev.Kv.Key)
+				if len(key) > 0 && k != key &&
+					!strings.HasPrefix(k, key+".") {
+					continue
+				}
+
+				e := WatchEvent{
+					Key:     k,
+					Value:   string(ev.Kv.Value),
+					Deleted: ev.Type == etcd.EventTypeDelete,
+				}
+
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
 		}
 
-		result = append(result,
-			KeyValue{Key: slashToDots(key), Value: string(n.Value)})
-	}
+		if ctx.Err() == nil {
+			fail(ErrStoreWatchEnded)
+		}
+	}()
 
-	return result, nil
+	return events, nil
+}
+
+// propertyKey returns the property key for an etcd key, with the prefix of
+// the store removed and slashes translated to dots.
+func (fcs *etcdStruct) propertyKey(etcdKey []byte) string {
+	key := strings.TrimPrefix(string(etcdKey), fcs.prefix)
+	key = strings.TrimPrefix(key, "/")
+
+	return slashToDots(key)
 }
 
 // Set creates or modifies the property indicated by key with the specified
@@ -178,15 +260,18 @@ func (fcs *etcdStruct) Set(key, val string) error {
 
 	_, err := fcs.client.Put(context.Background(), fcs.prefix+key, val)
 	if err != nil {
-		return err
+		return etcdWriteError(err, fcs.username,
+			strings.TrimPrefix(slashToDots(key), "."), "set")
 	}
 
 	return nil
 }
 
-// Delete removes a property from the store. The received key is translated to
-// use slashes instead of dots as field separators and the prefix specified in
-// the call to newEtcdFlexConfigStore is prepended.
+// Delete removes a property, and the properties below it, from the store.
+// The received key is translated to use slashes instead of dots as field
+// separators and the prefix specified in the call to newEtcdFlexConfigStore
+// is prepended. Properties whose keys merely start with the same characters,
+// such as logger.name when deleting log, are not removed.
 func (fcs *etcdStruct) Delete(key string) error {
 	if len(key) == 0 {
 		return ErrStoreKeyRequired
@@ -195,10 +280,58 @@ func (fcs *etcdStruct) Delete(key string) error {
 	// counting on dotsToSlash to add initial '/' if necessary
 	key = dotsToSlash(key)
 
-	_, err := fcs.client.Delete(context.Background(),
-		fcs.prefix+key, etcd.WithPrefix())
+	_, err := fcs.client.Txn(context.Background()).Then(
+		etcd.OpDelete(fcs.prefix+key),
+		etcd.OpDelete(fcs.prefix+key+"/", etcd.WithPrefix())).Commit()
 	if err != nil {
-		return err
+		return etcdWriteError(err, fcs.username,
+			strings.TrimPrefix(slashToDots(key), "."), "delete")
+	}
+
+	return nil
+}
+
+// ApplyBatch sets and deletes properties in a single etcd transaction, which
+// only succeeds if every property in expected still has the value given. A
+// property is deleted without the properties below it, unlike Delete. etcd
+// limits the number of operations in a transaction, 128 by default.
+func (fcs *etcdStruct) ApplyBatch(expected, desired map[string]string) error {
+	var cmps []etcd.Cmp
+	for _, k := range sortedKeys(expected) {
+		key := fcs.prefix + dotsToSlash(k)
+		if len(expected[k]) == 0 {
+			cmps = append(cmps,
+				etcd.Compare(etcd.CreateRevision(key), "=", 0))
+		} else {
+			cmps = append(cmps,
+				etcd.Compare(etcd.Value(key), "=", expected[k]))
+		}
+	}
+
+	var ops []etcd.Op
+	keys := sortedKeys(desired)
+	for _, k := range keys {
+		if len(k) == 0 {
+			return ErrStoreKeyRequired
+		}
+
+		key := fcs.prefix + dotsToSlash(k)
+		if len(desired[k]) == 0 {
+			ops = append(ops, etcd.OpDelete(key))
+		} else {
+			ops = append(ops, etcd.OpPut(key, desired[k]))
+		}
+	}
+
+	resp, err := fcs.client.Txn(context.Background()).If(cmps...).
+		Then(ops...).Commit()
+	if err != nil {
+		return etcdWriteError(err, fcs.username, strings.Join(keys, ", "),
+			"apply")
+	}
+
+	if !resp.Succeeded {
+		return ErrStoreChanged
 	}
 
 	return nil
@@ -209,3 +342,17 @@ func (fcs *etcdStruct) Delete(key string) error {
 func (fcs *etcdStruct) GetPrefix() string {
 	return fcs.prefix
 }
+
+// etcdWriteError converts an error returned by etcd for a write into a
+// *WriteDeniedError if etcd denied the write to the user.
+func etcdWriteError(err error, username, key, operation string) error {
+	if err == rpctypes.ErrPermissionDenied {
+		return &WriteDeniedError{
+			Identity:  username,
+			Key:       key,
+			Operation: operation,
+		}
+	}
+
+	return err
+}
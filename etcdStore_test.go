@@ -17,9 +17,11 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -213,3 +215,110 @@ func Test_etcd_badNames(t *testing.T) {
 		t.Errorf("Unexpected success deleting empty property name")
 	}
 }
+
+func Test_etcd_watch(t *testing.T) {
+	fcs, err := newEtcdFlexConfigStore(getEndpointList(), etcdTestPrefix)
+	if err != nil {
+		t.Errorf("Error creating store, have you defined ETCDCTL_ENDPOINTS?: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := fcs.(FlexConfigStoreWatcher).Watch(ctx, "watch.log")
+	if err != nil {
+		t.Errorf("Error watching property: %v", err)
+		return
+	}
+
+	// A property sharing only a leading string with the key is not reported
+	fcs.Set("watch.logger", "ignored")
+	fcs.Set("watch.log.filepath", "/var/log/app.log")
+	fcs.Delete("watch.log.filepath")
+
+	expected := []WatchEvent{
+		{Key: "watch.log.filepath", Value: "/var/log/app.log"},
+		{Key: "watch.log.filepath", Deleted: true},
+	}
+	for _, e := range expected {
+		select {
+		case ev := <-events:
+			if ev != e {
+				t.Errorf("Expected event %+v, found %+v", e, ev)
+			}
+		case <-ctx.Done():
+			t.Errorf("Timed out waiting for event %+v", e)
+			return
+		}
+	}
+
+	fcs.Delete("watch.logger")
+	cancel()
+	for ev := range events {
+		if ev.Err != nil {
+			t.Errorf("Unexpected error after cancel: %v", ev.Err)
+		}
+	}
+}
+
+func Test_etcd_applyBatch(t *testing.T) {
+	fcs, err := newEtcdFlexConfigStore(getEndpointList(), etcdTestPrefix)
+	if err != nil {
+		t.Errorf("Error creating store, have you defined ETCDCTL_ENDPOINTS?: %v", err)
+		return
+	}
+
+	batcher := fcs.(FlexConfigStoreBatcher)
+	fcs.Set("batch.a", "0")
+	fcs.Set("batch.a.below", "kept")
+	fcs.Delete("batch.b")
+
+	err = batcher.ApplyBatch(map[string]string{"batch.a": "0", "batch.b": ""},
+		map[string]string{"batch.a": "", "batch.b": "2"})
+	if err != nil {
+		t.Errorf("Error applying batch: %v", err)
+	}
+
+	a, _ := fcs.Get("batch.a")
+	below, _ := fcs.Get("batch.a.below")
+	b, _ := fcs.Get("batch.b")
+	if a != "" || below != "kept" || b != "2" {
+		t.Errorf("Unexpected values after batch: %q %q %q", a, below, b)
+	}
+
+	err = batcher.ApplyBatch(map[string]string{"batch.b": "1"},
+		map[string]string{"batch.b": "3"})
+	b, _ = fcs.Get("batch.b")
+	if err != ErrStoreChanged || b != "2" {
+		t.Errorf("Expected ErrStoreChanged without change: %v %q", err, b)
+	}
+
+	fcs.Delete("batch")
+}
+
+func Test_etcd_deleteSiblings(t *testing.T) {
+	fcs, err := newEtcdFlexConfigStore(getEndpointList(), etcdTestPrefix)
+	if err != nil {
+		t.Errorf("Error creating store, have you defined ETCDCTL_ENDPOINTS?: %v", err)
+		return
+	}
+
+	fcs.Set("siblings.a", "1")
+	fcs.Set("siblings.a.b", "2")
+	fcs.Set("siblings.ab.c", "3")
+
+	err = fcs.Delete("siblings.a")
+	if err != nil {
+		t.Errorf("Error deleting: %v", err)
+	}
+
+	a, _ := fcs.Get("siblings.a")
+	below, _ := fcs.Get("siblings.a.b")
+	sibling, _ := fcs.Get("siblings.ab.c")
+	if a != "" || below != "" || sibling != "3" {
+		t.Errorf("Unexpected values after delete: %q %q %q", a, below, sibling)
+	}
+
+	fcs.Delete("siblings")
+}
@@ -0,0 +1,347 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// ErrExportKeyConflict indicates a property cannot be exported in a
+	// nested format because it has a value and there are also
+	// properties below it, such as a.b and a.b.c.
+	ErrExportKeyConflict = errors.New("Property has both a value and properties below it")
+
+	// ErrExportKeyNotInSection indicates a property cannot be exported as
+	// INI because its key has a single component, such as name, leaving
+	// no section to write it in.
+	ErrExportKeyNotInSection = errors.New("Property key has no section")
+)
+
+// Export writes the properties of the global configuration to w in the
+// specified format. If the global configuration does not exist (no call has
+// been made to NewFlexibleConfiguration), an empty configuration is created.
+// If redact is true, the values of sensitive properties are replaced by
+// RedactedValue. Values read from a secret source, including a sensitive
+// Resolver, are always replaced.
+func Export(w io.Writer, format ConfigurationFormat, redact bool) error {
+	cfg := GetConfiguration().(ExtendedConfig)
+	return cfg.Export(w, format, redact)
+}
+
+// Export writes the properties of the configuration to w in the specified
+// format, using the value Get returns for each property, including those
+// found only in the configuration store. Properties with empty values are
+// not written. If redact is true, the values of sensitive properties are
+// replaced by RedactedValue. Values read from a secret source (an encrypted
+// value, a <VAR>_FILE environment variable, a secret directory, or a
+// Resolver created by SensitiveResolver, such as the file and Vault
+// resolvers), and values referring to them, are always replaced, so that
+// exporting does not write them in plain text; redact only controls the
+// redaction of properties matching SensitiveKeys.
+//
+// In YAML and JSON, keys are nested at each dot, and a level whose keys are
+// the indexes 0 to n-1 is written as an array, so that reading the output
+// yields the same properties. In INI, the last component of each key is
+// written in a section named by the components before it; reading the output
+// with an empty IniNamePrefix yields the same properties. A property whose
+// key has a single component cannot be written as INI, and
+// ErrExportKeyNotInSection is returned. The properties format writes each
+// property as key=value, and the env format writes each as a shell variable
+// assignment, with the name in upper case and each dot or dash replaced by an
+// underscore.
+func (fc *flexibleConfiguration) Export(
+	w io.Writer,
+	format ConfigurationFormat,
+	redact bool) error {
+	vars := fc.effectiveProperties()
+	for k, v := range vars {
+		if redact || fc.isSecret(k) {
+			vars[k] = fc.redact(k, v)
+		}
+	}
+
+	return writeProperties(w, format, vars)
+}
+
+// writeProperties writes the properties to w in the specified format, as
+// described for Export.
+func writeProperties(
+	w io.Writer,
+	format ConfigurationFormat,
+	vars map[string]string) error {
+	switch format {
+	case ConfigurationFormatYAML, ConfigurationFormatJSON:
+		tree, err := nestProperties(vars)
+		if err != nil {
+			return err
+		}
+
+		return writeNested(w, format, tree)
+	case ConfigurationFormatINI:
+		return writeIni(w, vars)
+	case ConfigurationFormatProperties:
+		return writeLines(w, vars, func(k, v string) string {
+			return k + "=" + escapePropertyValue(v)
+		})
+	case ConfigurationFormatEnv:
+		return writeLines(w, vars, func(k, v string) string {
+			return envVarNameForKey(k) + "=" + shellQuote(v)
+		})
+	default:
+		return ErrFormatNotRecognized
+	}
+}
+
+// effectiveProperties returns the current value of every property in the
+// memory store and the configuration store that has a value.
+func (fc *flexibleConfiguration) effectiveProperties() map[string]string {
+	keys := make(map[string]bool)
+	for k := range fc.config {
+		keys[strings.TrimSpace(k)] = true
+	}
+
+	if fc.store != nil {
+		kvs, err := fc.store.GetAll()
+		if err == nil {
+			for _, kv := range kvs {
+				keys[kv.Key] = true
+			}
+		}
+	}
+
+	for old, k := range fc.aliases {
+		if keys[old] {
+			keys[k] = true
+		}
+	}
+
+	vars := make(map[string]string)
+	for k := range keys {
+		val := fc.Get(k)
+		if len(k) > 0 && len(val) > 0 {
+			vars[k] = val
+		}
+	}
+
+	return vars
+}
+
+// nestProperties returns the properties as nested maps, with a level whose
+// keys are the indexes 0 to n-1 converted to an array.
+func nestProperties(vars map[string]string) (interface{}, error) {
+	root := make(map[string]interface{})
+	for _, k := range sortedKeys(vars) {
+		node := root
+		components := strings.Split(k, ".")
+		for i, c := range components {
+			if i == len(components)-1 {
+				if _, isMap := node[c].(map[string]interface{}); isMap {
+					return nil, fmt.Errorf("%w: %s", ErrExportKeyConflict, k)
+				}
+
+				node[c] = vars[k]
+				break
+			}
+
+			child, exists := node[c]
+			if !exists {
+				child = make(map[string]interface{})
+				node[c] = child
+			}
+
+			m, isMap := child.(map[string]interface{})
+			if !isMap {
+				return nil, fmt.Errorf("%w: %s", ErrExportKeyConflict,
+					strings.Join(components[:i+1], "."))
+			}
+
+			node = m
+		}
+	}
+
+	return arraysFromIndexes(root), nil
+}
+
+// arraysFromIndexes converts each map in the tree whose keys are the indexes
+// 0 to n-1 to an array.
+func arraysFromIndexes(node interface{}) interface{} {
+	m, isMap := node.(map[string]interface{})
+	if !isMap {
+		return node
+	}
+
+	for k, v := range m {
+		m[k] = arraysFromIndexes(v)
+	}
+
+	a := make([]interface{}, len(m))
+	for k, v := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(m) || strconv.Itoa(i) != k {
+			return m
+		}
+
+		a[i] = v
+	}
+
+	if len(a) == 0 {
+		return m
+	}
+
+	return a
+}
+
+// writeNested writes nested properties as YAML or JSON.
+func writeNested(
+	w io.Writer,
+	format ConfigurationFormat,
+	tree interface{}) error {
+	var contents []byte
+	var err error
+	if format == ConfigurationFormatJSON {
+		contents, err = json.MarshalIndent(tree, "", "  ")
+		contents = append(contents, '\n')
+	} else {
+		contents, err = yaml.Marshal(tree)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(contents)
+
+	return err
+}
+
+// writeIni writes the properties as INI, grouping them into sections named
+// by all but the last component of their keys. A property whose key has a
+// single component would be read back from before the first section with a
+// different key, so an error is returned instead.
+func writeIni(w io.Writer, vars map[string]string) error {
+	sections := make(map[string]map[string]string)
+	var names []string
+	for _, k := range sortedKeys(vars) {
+		index := strings.LastIndex(k, ".")
+		if index < 0 {
+			return fmt.Errorf("%w: %s", ErrExportKeyNotInSection, k)
+		}
+
+		section := k[:index]
+		name := k[index+1:]
+		v := vars[k]
+
+		if sections[section] == nil {
+			sections[section] = make(map[string]string)
+			names = append(names, section)
+		}
+
+		sections[section][name] = v
+	}
+
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for i, section := range names {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+
+		bw.WriteString("[" + section + "]\n")
+
+		for _, name := range sortedKeys(sections[section]) {
+			bw.WriteString(name + " = " +
+				iniQuote(sections[section][name]) + "\n")
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeLines writes one line for each property, in order of key, formatted
+// by the line function.
+func writeLines(
+	w io.Writer,
+	vars map[string]string,
+	line func(k, v string) string) error {
+	bw := bufio.NewWriter(w)
+	for _, k := range sortedKeys(vars) {
+		bw.WriteString(line(k, vars[k]) + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// sortedKeys returns the keys of the properties in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// iniQuote returns the value quoted if it would otherwise not be read back
+// unchanged.
+func iniQuote(val string) string {
+	if strings.ContainsAny(val, "\n\"`#;") || strings.TrimSpace(val) != val {
+		if strings.Contains(val, "\"\"\"") {
+			return "`" + val + "`"
+		}
+
+		return "\"\"\"" + val + "\"\"\""
+	}
+
+	return val
+}
+
+// escapePropertyValue escapes the characters of a value that cannot appear
+// in the properties format.
+func escapePropertyValue(val string) string {
+	val = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r",
+		"\t", "\\t").Replace(val)
+	if strings.HasPrefix(val, " ") {
+		val = "\\" + val
+	}
+
+	return val
+}
+
+// envVarNameForKey returns the environment variable name for a property,
+// the reverse of the conversion of environment variable names to property
+// names.
+func envVarNameForKey(k string) string {
+	return strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToUpper(k))
+}
+
+// shellQuote returns the value quoted for use in a shell.
+func shellQuote(val string) string {
+	return "'" + strings.Replace(val, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,262 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var exportTestProperties = map[string]string{
+	"server.port":         "8080",
+	"server.name":         "it's \"quoted\"",
+	"server.hosts.0.name": "a",
+	"server.hosts.1.name": "b",
+	"db.password":         "s3cret",
+	"db.url":              "postgres://db:5432",
+}
+
+func newExportTestConfig(t *testing.T) Config {
+	os.Args = []string{}
+
+	store := newMemStore("")
+	store.Set("store.only", "fromStore")
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		SensitiveKeys:      []string{"*.password"},
+		ConfigurationStore: store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return nil
+	}
+
+	for k, v := range exportTestProperties {
+		cfg.Set(k, v)
+	}
+
+	cfg.Set("empty.value", "")
+
+	return cfg
+}
+
+func Test_export_roundTrip(t *testing.T) {
+	cfg := newExportTestConfig(t)
+	if cfg == nil {
+		return
+	}
+
+	expected := make(map[string]string)
+	for k, v := range exportTestProperties {
+		expected[k] = v
+	}
+
+	expected["store.only"] = "fromStore"
+
+	for _, format := range []ConfigurationFormat{ConfigurationFormatYAML,
+		ConfigurationFormatJSON, ConfigurationFormatINI} {
+		var b bytes.Buffer
+		err := cfg.(ExtendedConfig).Export(&b, format, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", format, err)
+			continue
+		}
+
+		vars, err := ReadProperties(&b, format, "")
+		if err != nil {
+			t.Errorf("%s: unexpected error reading export: %v", format, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(vars, expected) {
+			t.Errorf("%s: expected %v, found %v", format, expected, vars)
+		}
+	}
+
+	var b bytes.Buffer
+	cfg.(ExtendedConfig).Export(&b, ConfigurationFormatJSON, false)
+	if !strings.Contains(b.String(), `"hosts": [`) {
+		t.Errorf("Expected array in JSON export: %s", b.String())
+	}
+}
+
+func Test_export_lines(t *testing.T) {
+	cfg := newExportTestConfig(t)
+	if cfg == nil {
+		return
+	}
+
+	var b bytes.Buffer
+	err := cfg.(ExtendedConfig).Export(&b, ConfigurationFormatProperties, true)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	if lines[0] != "db.password="+RedactedValue ||
+		lines[1] != "db.url=postgres://db:5432" ||
+		len(lines) != len(exportTestProperties)+2 {
+		t.Errorf("Unexpected properties export: %s", b.String())
+	}
+
+	b.Reset()
+	err = cfg.(ExtendedConfig).Export(&b, ConfigurationFormatEnv, false)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if !strings.Contains(b.String(), "DB_PASSWORD='s3cret'\n") ||
+		!strings.Contains(b.String(), `SERVER_NAME='it'\''s "quoted"'`) ||
+		!strings.Contains(b.String(), "STORE_ONLY='fromStore'\n") {
+		t.Errorf("Unexpected env export: %s", b.String())
+	}
+
+	if cfg.(ExtendedConfig).Export(&b, ConfigurationFormatUnknown, false) !=
+		ErrFormatNotRecognized {
+		t.Errorf("Expected ErrFormatNotRecognized for unknown format")
+	}
+}
+
+func Test_export_conflict(t *testing.T) {
+	_, err := nestProperties(map[string]string{"a.b": "1", "a.b.c": "2"})
+	if !errors.Is(err, ErrExportKeyConflict) ||
+		!strings.Contains(err.Error(), "a.b") {
+		t.Errorf("Expected ErrExportKeyConflict, found %v", err)
+	}
+
+	tree, err := nestProperties(map[string]string{"a.0": "x", "a.2": "y"})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, isMap := tree.(map[string]interface{})["a"].(map[string]interface{}); !isMap {
+		t.Errorf("Expected sparse indexes to remain a map: %v", tree)
+	}
+
+	var b bytes.Buffer
+	err = writeIni(&b, map[string]string{"a.b": "1", "name": "x"})
+	if !errors.Is(err, ErrExportKeyNotInSection) ||
+		!strings.Contains(err.Error(), "name") {
+		t.Errorf("Expected ErrExportKeyNotInSection, found %v", err)
+	}
+}
+
+func Test_export_secrets(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigExport")
+	if err != nil {
+		t.Errorf("Can't create temporary file")
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("from file")
+	f.Close()
+
+	os.Args = []string{}
+	os.Setenv("TEST_EXPORT_API_KEY_FILE", f.Name())
+	defer os.Unsetenv("TEST_EXPORT_API_KEY_FILE")
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		FileSystem:                  fstest.MapFS{},
+		EnvironmentVariablePrefixes: []string{"TEST_EXPORT_"},
+		FileEnvironmentVariables:    true,
+		SensitiveKeys:               []string{"*.password"},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("db.password", "s3cret")
+	cfg.Set("api.header", "Bearer ${test.export.api.key}")
+
+	var b bytes.Buffer
+	err = cfg.(ExtendedConfig).Export(&b, ConfigurationFormatProperties, false)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if b.String() != "api.header="+RedactedValue+"\n"+
+		"db.password=s3cret\n"+
+		"test.export.api.key="+RedactedValue+"\n" {
+		t.Errorf("Expected secrets to be redacted: %s", b.String())
+	}
+}
+
+func Test_export_sensitiveResolvers(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigExport")
+	if err != nil {
+		t.Errorf("Can't create temporary file")
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("topsecret")
+	f.Close()
+
+	_, server := newVaultStandIn(t)
+	defer server.Close()
+
+	r, err := NewVaultResolver(VaultConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error creating resolver: %v", err)
+		return
+	}
+
+	RegisterResolver("testvault", r)
+	defer RegisterResolver("testvault", nil)
+
+	os.Args = []string{}
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		FileSystem: fstest.MapFS{},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("db.password", "${file:"+f.Name()+"}")
+	cfg.Set("db.token", "${testvault://secret/data/db#password}")
+	cfg.Set("db.user", "app")
+
+	var b bytes.Buffer
+	err = cfg.(ExtendedConfig).Export(&b, ConfigurationFormatProperties, false)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if b.String() != "db.password="+RedactedValue+"\n"+
+		"db.token="+RedactedValue+"\n"+
+		"db.user=app\n" {
+		t.Errorf("Expected resolved secrets to be redacted: %s", b.String())
+	}
+}
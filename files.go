@@ -1,7 +1,7 @@
 package flexconfig
 
 /*
-Copyright 2018 The flexconfig Authors
+Copyright 2018-2019 The flexconfig Authors
 
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
@@ -17,23 +17,62 @@ limitations under the License.
 */
 
 import (
+	"io/fs"
 	"io/ioutil"
 	"os"
+	"path"
 	"sort"
 	"strings"
 )
 
+// fileOptions holds the settings that control how configuration files are
+// located and read.
+type fileOptions struct {
+	// fsys is the file system containing configuration files. If nil,
+	// the local file system is used.
+	fsys fs.FS
+
+	// iniPrefix is the property name prefix for properties read from
+	// INI files.
+	iniPrefix string
+
+	// cacheDir is the directory used to cache configuration files
+	// fetched from a URL.
+	cacheDir string
+
+	// maxDecompressedSize is the largest size allowed for the contents
+	// of a compressed configuration file after decompression.
+	maxDecompressedSize int64
+
+	// sources, if non-nil, records the file and line from which each
+	// property was read.
+	sources map[string][]Provenance
+
+	// layer is recorded as the layer from which each property was
+	// read. If empty, sourceFile is recorded.
+	layer string
+
+	// permissions, if non-nil, checks the permissions and owners of
+	// files and directories on the local file system before they are
+	// read.
+	permissions *permissionCheck
+
+	// signatures, if non-nil, verifies the signature of each
+	// configuration file before it is parsed.
+	signatures *signatureCheck
+}
+
 // readConfigFiles performs a search for config files in an ordered set of
 // standard directories that may contain configuration. The specified name is
 // the last field of the name of a directory in one of the standard locations.
 // Configuration files found at that directory are read, creating configuration
 // properties.
-func readConfigFiles(vars map[string]string, name string, suffixes []string, iniPrefix string) {
-	readFiles(vars, "/usr/local/etc/"+name, suffixes, iniPrefix)
-	readFiles(vars, "/opt/etc/"+name, suffixes, iniPrefix)
-	readFiles(vars, "/opt/"+name+"/etc", suffixes, iniPrefix)
-	readFiles(vars, "/etc/opt/"+name, suffixes, iniPrefix)
-	readFiles(vars, "/etc/"+name, suffixes, iniPrefix)
+func readConfigFiles(vars map[string]string, name string, suffixes []string, opts *fileOptions) {
+	readFiles(vars, "/usr/local/etc/"+name, suffixes, opts)
+	readFiles(vars, "/opt/etc/"+name, suffixes, opts)
+	readFiles(vars, "/opt/"+name+"/etc", suffixes, opts)
+	readFiles(vars, "/etc/opt/"+name, suffixes, opts)
+	readFiles(vars, "/etc/"+name, suffixes, opts)
 
 	homedir := os.Getenv("HOME")
 	if len(homedir) > 0 {
@@ -42,41 +81,51 @@ func readConfigFiles(vars map[string]string, name string, suffixes []string, ini
 			dir = dir + "/"
 		}
 
-		readFiles(vars, dir+"."+name, suffixes, iniPrefix)
+		readFiles(vars, dir+"."+name, suffixes, opts)
 	}
 
 	// If the current working directory is the same as $HOME, this will
 	// read a set of config files a second time. There should be no change
 	// in the resulting configuration.
-	readFiles(vars, "."+name, suffixes, iniPrefix)
+	readFiles(vars, "."+name, suffixes, opts)
+}
+
+// readDefaultFiles reads the configuration files in the top level directory
+// of a file system holding default configuration, such as an embed.FS.
+func readDefaultFiles(vars map[string]string, fsys fs.FS, suffixes []string, opts *fileOptions) {
+	defaultOpts := *opts
+	defaultOpts.fsys = fsys
+	defaultOpts.signatures = nil
+	defaultOpts.layer = sourceDefault
+	readFiles(vars, ".", suffixes, &defaultOpts)
 }
 
 // readFiles checks for and reads configuration files in a single directory.
 // If the directory exists, files with any of the specified suffixes are
 // read and configuration properties created.
-func readFiles(vars map[string]string, dirname string, suffixes []string, iniPrefix string) {
-	dir, err := os.Open(dirname)
+func readFiles(vars map[string]string, dirname string, suffixes []string, opts *fileOptions) {
+	filenames, err := opts.readDirNames(dirname)
 	if err != nil {
 		return
 	}
 
-	defer dir.Close()
-
-	filenames, err := dir.Readdirnames(0)
-	if err != nil {
+	if filenames == nil || len(filenames) == 0 {
 		return
 	}
 
-	if filenames == nil || len(filenames) == 0 {
+	if opts.fsys == nil && !opts.permissions.allow(dirname, false) {
 		return
 	}
 
 	sort.Strings(filenames)
 
 	for _, f := range filenames {
+		// A compressed file is selected by the suffix preceding the
+		// compression suffix, for example "app.conf.gz" for ".conf".
+		name := uncompressedName(f)
 		for _, suffix := range suffixes {
-			if strings.HasSuffix(f, suffix) {
-				readConfigFile(vars, dirname, f, iniPrefix)
+			if strings.HasSuffix(name, suffix) {
+				readConfigFile(vars, dirname, f, opts)
 			}
 		}
 	}
@@ -84,22 +133,111 @@ func readFiles(vars map[string]string, dirname string, suffixes []string, iniPre
 
 // readConfigFile reads a single configuration file and creates configuration
 // properties based on its contents. If file contents are json, yaml, or ini,
-// properties are created. Other file types are ignored.
-func readConfigFile(vars map[string]string, path string, name string, iniPrefix string) {
-	fileContents, err := ioutil.ReadFile(path + "/" + name)
+// properties are created. Other file types are ignored. A compressed file is
+// decompressed before its contents are parsed, and is ignored if its
+// decompressed contents exceed the size limit. A file on the local file
+// system is ignored if its permissions are rejected, and any file is ignored
+// if its signature is required but cannot be verified.
+func readConfigFile(vars map[string]string, path string, name string, opts *fileOptions) {
+	filename := path + "/" + name
+	fileContents, err := opts.readFile(filename)
 	if err != nil {
 		return
 	}
 
-	contents := string(fileContents)
+	if !opts.signatures.allow(filename, fileContents, func() ([]byte, error) {
+		return opts.readFile(filename + signatureSuffix)
+	}) {
+		return
+	}
 
-	// Parse either yaml or json
-	err = parseYaml(vars, contents)
-	if err != nil {
-		// File contents were neither YAML nor JSON, try INI
-		err = parseIniFile(vars, iniPrefix, contents)
+	suffix := compressionSuffix(name)
+	if len(suffix) > 0 {
+		fileContents, err = decompress(fileContents, suffix,
+			opts.maxDecompressedSize)
 		if err != nil {
-			// Unknown file type, ignore the file
+			return
+		}
+	}
+
+	fileVars := make(map[string]string)
+	parseConfigContents(fileVars, configFormatFromName(uncompressedName(name)),
+		string(fileContents), opts.iniPrefix)
+
+	if opts.fsys == nil && opts.permissions != nil &&
+		!opts.permissions.allow(filename,
+			opts.permissions.holdsSensitive(fileVars)) {
+		return
+	}
+
+	opts.merge(vars, fileVars, filename, string(fileContents))
+}
+
+// merge copies the properties read from a single file into vars, recording
+// the file and the line defining each property as its source if sources are
+// being recorded.
+func (opts *fileOptions) merge(
+	vars, fileVars map[string]string,
+	filename, contents string) {
+	layer := opts.layer
+	if len(layer) == 0 {
+		layer = sourceFile
+	}
+
+	for k, v := range fileVars {
+		vars[k] = v
+		if opts.sources != nil {
+			recordProvenance(opts.sources, k, Provenance{Layer: layer,
+				Path: filename, Line: propertyLine(contents, k), Value: v})
 		}
 	}
 }
+
+// readDirNames returns the names of the entries in the specified directory,
+// either on the local file system or in the file system in the options.
+func (opts *fileOptions) readDirNames(dirname string) ([]string, error) {
+	if opts.fsys == nil {
+		dir, err := os.Open(dirname)
+		if err != nil {
+			return nil, err
+		}
+
+		defer dir.Close()
+
+		return dir.Readdirnames(0)
+	}
+
+	entries, err := fs.ReadDir(opts.fsys, fsPath(dirname))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names, nil
+}
+
+// readFile returns the contents of the specified file, either from the local
+// file system or from the file system in the options.
+func (opts *fileOptions) readFile(filename string) ([]byte, error) {
+	if opts.fsys == nil {
+		return ioutil.ReadFile(filename)
+	}
+
+	return fs.ReadFile(opts.fsys, fsPath(filename))
+}
+
+// fsPath converts a path on the local file system to the equivalent path in
+// an fs.FS, which is unrooted. Absolute paths are treated as relative to the
+// root of the fs.FS, as are paths relative to the current directory.
+func fsPath(name string) string {
+	p := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if len(p) == 0 {
+		return "."
+	}
+
+	return p
+}
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"testing/fstest"
 )
 
 const (
@@ -28,7 +29,7 @@ const (
 
 func Test_files(t *testing.T) {
 	v := make(map[string]string)
-	readConfigFiles(v, appName, []string{".conf"}, "test")
+	readConfigFiles(v, appName, []string{".conf"}, &fileOptions{iniPrefix: "test"})
 
 	if len(v) != 6 {
 		t.Errorf("Unexpected number of properties: %d", len(v))
@@ -69,7 +70,7 @@ func Test_files(t *testing.T) {
 
 func Test_files_differentSuffix(t *testing.T) {
 	v := make(map[string]string)
-	readConfigFiles(v, appName, []string{".xyz"}, "")
+	readConfigFiles(v, appName, []string{".xyz"}, &fileOptions{})
 
 	if len(v) != 1 {
 		t.Errorf("Unexpected number of properties: %d", len(v))
@@ -91,9 +92,64 @@ func Test_files_emptyDir(t *testing.T) {
 	localAppName := name[1:]
 
 	v := make(map[string]string)
-	readConfigFiles(v, localAppName, []string{".conf"}, "")
+	readConfigFiles(v, localAppName, []string{".conf"}, &fileOptions{})
 
 	if len(v) > 0 {
 		t.Errorf("Unexpected properties found in empty directory: %d", len(v))
 	}
 }
+
+func Test_files_fileSystem(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/fsApp/a.conf":      {Data: []byte("test.fs.one: from etc\ntest.fs.two: from etc\n")},
+		"etc/fsApp/b.txt":       {Data: []byte("test.fs.three: ignored\n")},
+		".fsApp/local.conf":     {Data: []byte(`{"test.fs.two": "from local"}`)},
+		"usr/local/etc/other/x": {Data: []byte("test.fs.four: ignored\n")},
+	}
+
+	v := make(map[string]string)
+	readConfigFiles(v, "fsApp", []string{".conf"}, &fileOptions{fsys: fsys})
+
+	if len(v) != 2 {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+
+	if v["test.fs.one"] != "from etc" {
+		t.Errorf("Unexpected value: %s", v["test.fs.one"])
+	}
+
+	if v["test.fs.two"] != "from local" {
+		t.Errorf("Unexpected value: %s", v["test.fs.two"])
+	}
+}
+
+func Test_files_defaultFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"defaults.conf": {Data: []byte("[server]\nport=8080\n")},
+	}
+
+	v := make(map[string]string)
+	readDefaultFiles(v, fsys, []string{".conf"}, &fileOptions{iniPrefix: "app"})
+
+	if v["app.server.port"] != "8080" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+}
+
+func Test_files_fsPath(t *testing.T) {
+	paths := map[string]string{
+		"/etc/app/a.conf":   "etc/app/a.conf",
+		".app/a.conf":       ".app/a.conf",
+		"./.app":            ".app",
+		"/":                 ".",
+		".":                 ".",
+		"../../etc/passwd":  "etc/passwd",
+		"/home/user/.app/x": "home/user/.app/x",
+	}
+
+	for p, expected := range paths {
+		if fsPath(p) != expected {
+			t.Errorf("Unexpected path for %s: %s", p, fsPath(p))
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ConfigurationFormat is an enumerated type defining the format of the
+// contents of a configuration file.
+type ConfigurationFormat int
+
+const (
+	// ConfigurationFormatUnknown is a value of ConfigurationFormat
+	// indicating the format is not known and should be detected from the
+	// contents: YAML or JSON is tried first, followed by INI.
+	ConfigurationFormatUnknown ConfigurationFormat = iota
+
+	// ConfigurationFormatYAML is a value of ConfigurationFormat indicating
+	// the contents are YAML.
+	ConfigurationFormatYAML
+
+	// ConfigurationFormatJSON is a value of ConfigurationFormat indicating
+	// the contents are JSON.
+	ConfigurationFormatJSON
+
+	// ConfigurationFormatINI is a value of ConfigurationFormat indicating
+	// the contents are INI.
+	ConfigurationFormatINI
+
+	// ConfigurationFormatProperties is a value of ConfigurationFormat
+	// indicating the contents are lines of key=value. It is supported only
+	// by Export.
+	ConfigurationFormatProperties
+
+	// ConfigurationFormatEnv is a value of ConfigurationFormat indicating
+	// the contents are environment variable assignments for a shell. It is
+	// supported only by Export.
+	ConfigurationFormatEnv
+)
+
+var (
+	// ErrFormatNotRecognized indicates the contents of a configuration
+	// file could not be parsed in any supported format.
+	ErrFormatNotRecognized = errors.New("Configuration format not recognized")
+)
+
+// ReadProperties reads configuration contents having the specified format
+// from r and returns the properties defined by the contents. The iniPrefix
+// is used as the property name prefix for contents in INI format, as
+// described for IniNamePrefix in ConfigurationParameters. If format is
+// ConfigurationFormatUnknown, the format is detected from the contents.
+func ReadProperties(
+	r io.Reader,
+	format ConfigurationFormat,
+	iniPrefix string) (map[string]string, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	err = parseConfigContents(vars, format, string(contents), iniPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+// parseConfigContents creates configuration properties from the contents of
+// a configuration file having the specified format. If the format is unknown,
+// the contents are parsed as YAML or JSON and then as INI, and contents
+// having neither format result in ErrFormatNotRecognized, as do formats
+// that can only be written.
+func parseConfigContents(
+	vars map[string]string,
+	format ConfigurationFormat,
+	contents, iniPrefix string) error {
+	switch format {
+	case ConfigurationFormatYAML, ConfigurationFormatJSON:
+		return parseYaml(vars, contents)
+	case ConfigurationFormatINI:
+		return parseIniFile(vars, iniPrefix, contents)
+	case ConfigurationFormatProperties, ConfigurationFormatEnv:
+		return ErrFormatNotRecognized
+	}
+
+	// Parse either yaml or json
+	err := parseYaml(vars, contents)
+	if err != nil {
+		// Contents were neither YAML nor JSON, try INI
+		err = parseIniFile(vars, iniPrefix, contents)
+		if err != nil {
+			return ErrFormatNotRecognized
+		}
+	}
+
+	return nil
+}
+
+// configFormatFromName returns the format of a configuration file implied by
+// the suffix of its name. Names with a suffix not specific to a format, such
+// as ".conf", result in ConfigurationFormatUnknown.
+func configFormatFromName(name string) ConfigurationFormat {
+	switch {
+	case strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".yml"):
+		return ConfigurationFormatYAML
+	case strings.HasSuffix(name, ".json"):
+		return ConfigurationFormatJSON
+	case strings.HasSuffix(name, ".ini"):
+		return ConfigurationFormatINI
+	default:
+		return ConfigurationFormatUnknown
+	}
+}
+
+// String returns the string representation of the ConfigurationFormat.
+func (cf ConfigurationFormat) String() string {
+	switch cf {
+	case ConfigurationFormatYAML:
+		return "yaml"
+	case ConfigurationFormatJSON:
+		return "json"
+	case ConfigurationFormatINI:
+		return "ini"
+	case ConfigurationFormatProperties:
+		return "properties"
+	case ConfigurationFormatEnv:
+		return "env"
+	default:
+		return "unknown"
+	}
+}
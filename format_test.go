@@ -0,0 +1,97 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_format_readProperties(t *testing.T) {
+	v, err := ReadProperties(strings.NewReader("a:\n  b: yaml\n"),
+		ConfigurationFormatYAML, "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if v["a.b"] != "yaml" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+
+	v, err = ReadProperties(strings.NewReader("[sect]\nkey=ini\n"),
+		ConfigurationFormatINI, "pre")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if v["pre.sect.key"] != "ini" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+
+	v, err = ReadProperties(strings.NewReader(`{"a": {"c": "json"}}`),
+		ConfigurationFormatUnknown, "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if v["a.c"] != "json" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+}
+
+func Test_format_readPropertiesBadContents(t *testing.T) {
+	_, err := ReadProperties(strings.NewReader("a: [unterminated"),
+		ConfigurationFormatYAML, "")
+	if err == nil {
+		t.Errorf("Unexpected success parsing bad YAML")
+	}
+}
+
+func Test_format_readPropertiesNullAndNumericKeys(t *testing.T) {
+	vars, err := ReadProperties(strings.NewReader("a:\n1: x\n"),
+		ConfigurationFormatYAML, "")
+	if err != nil || len(vars) != 1 || vars["1"] != "x" {
+		t.Errorf("Unexpected properties: %v (%v)", vars, err)
+	}
+}
+
+func Test_format_fromName(t *testing.T) {
+	names := map[string]ConfigurationFormat{
+		"app.yaml": ConfigurationFormatYAML,
+		"app.yml":  ConfigurationFormatYAML,
+		"app.json": ConfigurationFormatJSON,
+		"app.ini":  ConfigurationFormatINI,
+		"app.conf": ConfigurationFormatUnknown,
+	}
+
+	for name, expected := range names {
+		if configFormatFromName(name) != expected {
+			t.Errorf("Unexpected format for %s: %s",
+				name, configFormatFromName(name))
+		}
+	}
+}
+
+func Test_format_string(t *testing.T) {
+	if ConfigurationFormatJSON.String() != "json" {
+		t.Errorf("Unexpected string: %s", ConfigurationFormatJSON)
+	}
+
+	if ConfigurationFormat(42).String() != "unknown" {
+		t.Errorf("Unexpected string: %s", ConfigurationFormat(42))
+	}
+}
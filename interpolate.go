@@ -0,0 +1,287 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	referenceStart   = "${"
+	referenceEnd     = "}"
+	referenceEscape  = "$${"
+	referenceDefault = ":-"
+)
+
+var (
+	// ErrReferenceCycle indicates a property value refers, directly or
+	// through other properties, to itself.
+	ErrReferenceCycle = errors.New("Property reference cycle")
+)
+
+// interpolator resolves references of the form ${key} and ${key:-default}
+// in property values. The lookup function returns the unresolved value of a
+// property, and the stack records the properties being resolved in order to
+// detect cycles.
+//
+// References of the form ${scheme:ref} are resolved using the resolvers
+// function, which returns the Resolver for a scheme. If resolvers is nil,
+// such references are left unresolved, as they are in the value of a
+// property for which the trusted function returns false. Values produced by
+// a Resolver are kept in the cache, and the source function describes where
+// a property was defined when reporting a failure to resolve a reference.
+// The reference is not included in the report if the sensitive function
+// reports that the property is sensitive.
+type interpolator struct {
+	lookup    func(key string) string
+	resolvers func(scheme string) Resolver
+	trusted   func(key string) bool
+	cache     *resolverCache
+	source    func(key string) string
+	sensitive func(key string) bool
+	stack     []string
+}
+
+// newInterpolator returns an interpolator resolving references using the
+// specified lookup function.
+func newInterpolator(lookup func(key string) string) *interpolator {
+	return &interpolator{lookup: lookup}
+}
+
+// resolveProperty returns the value of the property with all references
+// resolved.
+func (ip *interpolator) resolveProperty(key, val string) (string, error) {
+	for i, k := range ip.stack {
+		if k == key {
+			cycle := append(append([]string{}, ip.stack[i:]...), key)
+			return "", fmt.Errorf("%w: %s", ErrReferenceCycle,
+				strings.Join(cycle, " -> "))
+		}
+	}
+
+	ip.stack = append(ip.stack, key)
+	defer func() { ip.stack = ip.stack[:len(ip.stack)-1] }()
+
+	return ip.resolveValue(val)
+}
+
+// resolveValue returns the value with all references resolved. The sequence
+// $${ is replaced by ${ without being treated as the start of a reference.
+// A reference to a property with no value and no default is left unchanged.
+func (ip *interpolator) resolveValue(val string) (string, error) {
+	if !strings.Contains(val, referenceStart) {
+		return val, nil
+	}
+
+	var result strings.Builder
+	for len(val) > 0 {
+		if strings.HasPrefix(val, referenceEscape) {
+			result.WriteString(referenceStart)
+			val = val[len(referenceEscape):]
+			continue
+		}
+
+		if !strings.HasPrefix(val, referenceStart) {
+			result.WriteByte(val[0])
+			val = val[1:]
+			continue
+		}
+
+		end := referenceEndIndex(val)
+		if end < 0 {
+			// An unterminated reference is not a reference
+			result.WriteString(val)
+			break
+		}
+
+		resolved, err := ip.resolveReference(val[len(referenceStart):end])
+		if err != nil {
+			return "", err
+		}
+
+		result.WriteString(resolved)
+		val = val[end+len(referenceEnd):]
+	}
+
+	return result.String(), nil
+}
+
+// resolveReference returns the value for the expression found between ${
+// and }, which is a property key optionally followed by :- and a default
+// value.
+func (ip *interpolator) resolveReference(expr string) (string, error) {
+	key, def, hasDefault := splitReferenceDefault(expr)
+
+	val, err := ip.resolveKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(val) > 0 {
+		return val, nil
+	}
+
+	if hasDefault {
+		return ip.resolveValue(def)
+	}
+
+	return referenceStart + expr + referenceEnd, nil
+}
+
+// splitReferenceDefault splits the expression found between ${ and } into
+// the key and the default value following :-. The returned bool indicates
+// whether a default value is present.
+func splitReferenceDefault(expr string) (string, string, bool) {
+	index := strings.Index(expr, referenceDefault)
+	if index < 0 {
+		return strings.TrimSpace(expr), "", false
+	}
+
+	return strings.TrimSpace(expr[:index]),
+		expr[index+len(referenceDefault):], true
+}
+
+// forEachReference calls fn with the expression of each reference in val,
+// skipping escaped references, until fn returns false.
+func forEachReference(val string, fn func(expr string) bool) {
+	for len(val) > 0 {
+		index := strings.Index(val, referenceStart)
+		if index < 0 {
+			return
+		}
+
+		if index > 0 && val[index-1] == '$' {
+			val = val[index+len(referenceStart):]
+			continue
+		}
+
+		val = val[index:]
+		end := referenceEndIndex(val)
+		if end < 0 {
+			return
+		}
+
+		if !fn(val[len(referenceStart):end]) {
+			return
+		}
+
+		val = val[end+len(referenceEnd):]
+	}
+}
+
+// resolveKey returns the value for the key of a reference, which is either
+// a property key or a scheme and a reference for the Resolver registered for
+// that scheme.
+func (ip *interpolator) resolveKey(key string) (string, error) {
+	scheme, ref, ok := splitSchemeReference(key)
+	if !ok || ip.resolvers == nil || !ip.resolversTrusted() {
+		return ip.resolveProperty(key, ip.lookup(key))
+	}
+
+	r := ip.resolvers(scheme)
+	if r == nil {
+		return ip.resolveProperty(key, ip.lookup(key))
+	}
+
+	val, err := ip.cache.resolve(r, scheme, ref)
+	if err != nil {
+		return "", ip.referenceError(key, err)
+	}
+
+	return val, nil
+}
+
+// resolversTrusted returns whether Resolvers may be used for the references
+// in the value of the property being resolved.
+func (ip *interpolator) resolversTrusted() bool {
+	if ip.trusted == nil || len(ip.stack) == 0 {
+		return true
+	}
+
+	return ip.trusted(ip.stack[len(ip.stack)-1])
+}
+
+// referenceError returns an error describing the failure to resolve a
+// reference, naming the property containing the reference and its source.
+func (ip *interpolator) referenceError(ref string, err error) error {
+	key := ""
+	if len(ip.stack) > 0 {
+		key = ip.stack[len(ip.stack)-1]
+	}
+
+	source := "unknown source"
+	if ip.source != nil {
+		source = ip.source(key)
+	}
+
+	if ip.sensitive != nil && ip.sensitive(key) {
+		scheme, _, _ := splitSchemeReference(ref)
+		ref = scheme + referenceSchemeSeparator + RedactedValue
+	}
+
+	return fmt.Errorf("Unable to resolve ${%s} in property %s from %s: %w",
+		ref, key, source, err)
+}
+
+// referenceEndIndex returns the index of the } ending the reference that
+// starts at the beginning of val, allowing references to be nested in a
+// default value. If the reference is not terminated, -1 is returned.
+func referenceEndIndex(val string) int {
+	depth := 0
+	for i := 0; i < len(val); i++ {
+		switch {
+		case strings.HasPrefix(val[i:], referenceStart):
+			depth++
+			i += len(referenceStart) - 1
+		case strings.HasPrefix(val[i:], referenceEnd):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// checkReferences resolves the references in every property, returning an
+// error naming the first property, in key order, whose references cannot be
+// resolved.
+func checkReferences(vars map[string]string) error {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	ip := newInterpolator(func(key string) string {
+		return vars[key]
+	})
+
+	for _, k := range keys {
+		_, err := ip.resolveProperty(k, vars[k])
+		if err != nil {
+			return fmt.Errorf("Unable to resolve property %s: %w", k, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func resolveTestValue(vars map[string]string, key string) (string, error) {
+	ip := newInterpolator(func(k string) string {
+		return vars[k]
+	})
+
+	return ip.resolveProperty(key, vars[key])
+}
+
+func Test_interpolate_references(t *testing.T) {
+	vars := map[string]string{
+		"server.host": "example.com",
+		"server.port": "8080",
+		"server.url":  "http://${server.host}:${server.port}/",
+		"server.api":  "${server.url}api",
+		"log.level":   "${log.override:-info}",
+		"log.file":    "${log.dir:-/var/log/${server.host}}/app.log",
+		"literal":     "cost: $${price} and $$5",
+		"unknown":     "${no.such.key}",
+		"unfinished":  "${server.host",
+	}
+
+	expected := map[string]string{
+		"server.url": "http://example.com:8080/",
+		"server.api": "http://example.com:8080/api",
+		"log.level":  "info",
+		"log.file":   "/var/log/example.com/app.log",
+		"literal":    "cost: ${price} and $$5",
+		"unknown":    "${no.such.key}",
+		"unfinished": "${server.host",
+	}
+
+	for k, e := range expected {
+		val, err := resolveTestValue(vars, k)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %v", k, err)
+		}
+
+		if val != e {
+			t.Errorf("Unexpected value for %s: %s", k, val)
+		}
+	}
+}
+
+func Test_interpolate_cycle(t *testing.T) {
+	vars := map[string]string{
+		"a": "${b}",
+		"b": "x${c}",
+		"c": "${a}",
+		"d": "${d:-self}",
+	}
+
+	_, err := resolveTestValue(vars, "a")
+	if !errors.Is(err, ErrReferenceCycle) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err != nil && !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("Error does not describe cycle: %v", err)
+	}
+
+	_, err = resolveTestValue(vars, "d")
+	if !errors.Is(err, ErrReferenceCycle) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err = checkReferences(vars)
+	if err == nil || !strings.Contains(err.Error(), "property a:") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	delete(vars, "c")
+	delete(vars, "d")
+	err = checkReferences(vars)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func Test_interpolate_configuration(t *testing.T) {
+	os.Args = []string{}
+	fsys := fstest.MapFS{
+		"etc/refApp/app.conf": {Data: []byte(
+			"server:\n  host: localhost\n  port: 80\n" +
+				"  url: http://${server.host}:${server.port}\n")},
+	}
+
+	store := newMemStore("")
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName:    "refApp",
+		FileSystem:         fsys,
+		ConfigurationStore: store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if c.Get("server.url") != "http://localhost:80" {
+		t.Errorf("Unexpected value: %s", c.Get("server.url"))
+	}
+
+	store.Set("server.host", "example.com")
+	if c.Get("server.url") != "http://example.com:80" {
+		t.Errorf("Store value not used: %s", c.Get("server.url"))
+	}
+
+	c, err = NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName:      "refApp",
+		FileSystem:           fsys,
+		DisableInterpolation: true,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if c.Get("server.url") != "http://${server.host}:${server.port}" {
+		t.Errorf("Unexpected value: %s", c.Get("server.url"))
+	}
+
+	_, err = NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "refApp",
+		FileSystem: fstest.MapFS{
+			"etc/refApp/app.conf": {Data: []byte("a: ${b}\nb: ${a}\n")},
+		},
+	})
+	if !errors.Is(err, ErrReferenceCycle) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnknownProperty indicates a property was read that is not one of
+	// the KnownKeys, when StrictKeys is set.
+	ErrUnknownProperty = errors.New("Unknown property")
+)
+
+// UnknownKey describes a property that is not one of the KnownKeys. Source
+// describes where it was defined, without its value. Suggestion is the
+// known key nearest to it, or empty if no known key is close enough to be a
+// likely correction.
+type UnknownKey struct {
+	Key        string
+	Source     Provenance
+	Suggestion string
+}
+
+// String returns a description of the unknown property.
+func (uk UnknownKey) String() string {
+	description := uk.Key + " from " + uk.Source.String()
+	if len(uk.Suggestion) > 0 {
+		description += ", did you mean " + uk.Suggestion + "?"
+	}
+
+	return description
+}
+
+// UnknownKeys returns the properties in the memory store that are not one
+// of the KnownKeys, in order of key. Nothing is returned if no KnownKeys
+// were specified.
+func (fc *flexibleConfiguration) UnknownKeys() []UnknownKey {
+	return fc.findUnknownKeys(fc.config, func(k string) Provenance {
+		source, _ := currentProvenance(fc.sources, k)
+		return source
+	})
+}
+
+// checkKnownKeys reports the properties that are not one of the KnownKeys.
+// With StrictKeys, an error describing them is returned; otherwise each is
+// reported as a warning.
+func (fc *flexibleConfiguration) checkKnownKeys(
+	vars map[string]string,
+	source func(k string) Provenance) error {
+	unknown := fc.findUnknownKeys(vars, source)
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	if fc.strictKeys {
+		descriptions := make([]string, len(unknown))
+		for i, uk := range unknown {
+			descriptions[i] = uk.String()
+		}
+
+		return fmt.Errorf("%w: %s", ErrUnknownProperty,
+			strings.Join(descriptions, "; "))
+	}
+
+	for _, uk := range unknown {
+		fc.warn(fmt.Sprintf("%s: %s", ErrUnknownProperty, uk))
+	}
+
+	return nil
+}
+
+// findUnknownKeys returns the properties that are not one of the KnownKeys,
+// in order of key, describing where each was defined using the source
+// function.
+func (fc *flexibleConfiguration) findUnknownKeys(
+	vars map[string]string,
+	source func(k string) Provenance) []UnknownKey {
+	if len(fc.knownKeys) == 0 {
+		return nil
+	}
+
+	var unknown []UnknownKey
+	for _, k := range sortedKeys(vars) {
+		k = strings.TrimSpace(k)
+		_, aliased := fc.aliases[k]
+		if aliased || k == flexconfigCommandlineFileLocation ||
+			matchesKeyPattern(fc.knownKeys, k) {
+			continue
+		}
+
+		s := source(k)
+		s.Value = ""
+		unknown = append(unknown, UnknownKey{Key: k, Source: s,
+			Suggestion: suggestKey(fc.knownKeys, k)})
+	}
+
+	return unknown
+}
+
+// suggestKey returns the known key with the smallest edit distance from the
+// unknown key, or an empty string if none is within a third of its length.
+// A pattern ending in ".*" is compared with the same number of leading
+// components of the key, and suggested with the rest of the key appended.
+func suggestKey(known []string, k string) string {
+	suggestion := ""
+	best := -1
+	for _, candidate := range known {
+		target := k
+		rest := ""
+		if strings.HasSuffix(candidate, ".*") {
+			candidate = strings.TrimSuffix(candidate, ".*")
+			count := strings.Count(candidate, ".") + 1
+			components := strings.SplitN(k, ".", count+1)
+			if len(components) <= count {
+				continue
+			}
+
+			target = strings.Join(components[:count], ".")
+			rest = "." + components[count]
+		} else if strings.Contains(candidate, "*") {
+			continue
+		}
+
+		d := editDistance(candidate, target)
+		if d > len(candidate)/3 || (best >= 0 && d >= best) {
+			continue
+		}
+
+		best = d
+		suggestion = candidate + rest
+	}
+
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between two strings: the
+// number of single character insertions, deletions, and substitutions
+// needed to change one into the other.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1,
+				previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// minInt returns the smallest of the values.
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
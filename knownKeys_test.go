@@ -0,0 +1,147 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+var knownKeysTest = []string{"database.*", "server.port", "server.host"}
+
+func Test_knownKeys_warnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigKnownKeys")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/app.yaml"
+	ioutil.WriteFile(filename, []byte("databse:\n  host: db\n"+
+		"database:\n  port: 5432\nserver:\n  prot: 80\n"), 0600)
+	os.Setenv(flexConfigEnvFileLocation, filename)
+	defer os.Unsetenv(flexConfigEnvFileLocation)
+	os.Args = []string{"test", "--unrelated.flag=x"}
+	defer func() { os.Args = []string{} }()
+
+	var warnings []string
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		KnownKeys: knownKeysTest,
+		WarningHandler: func(warning string) {
+			warnings = append(warnings, warning)
+		},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	expected := []UnknownKey{
+		{Key: "databse.host",
+			Source:     Provenance{Layer: sourceFile, Path: filename, Line: 2},
+			Suggestion: "database.host"},
+		{Key: "server.prot",
+			Source:     Provenance{Layer: sourceFile, Path: filename, Line: 6},
+			Suggestion: "server.port"},
+		{Key: "unrelated.flag",
+			Source: Provenance{Layer: sourceCommandLine, Argument: 1}},
+	}
+
+	unknown := cfg.(ExtendedConfig).UnknownKeys()
+	if len(unknown) != len(expected) {
+		t.Errorf("Expected %d unknown keys, found %v", len(expected), unknown)
+		return
+	}
+
+	for i, uk := range expected {
+		if unknown[i] != uk {
+			t.Errorf("Key %d: expected %+v, found %+v", i, uk, unknown[i])
+		}
+	}
+
+	if len(warnings) != 3 || warnings[0] != "Unknown property: databse.host "+
+		"from "+filename+":2, did you mean database.host?" {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	warnings = nil
+	err = cfg.(ExtendedConfig).Load(strings.NewReader("server.hots: x\n"),
+		ConfigurationFormatYAML)
+	if err != nil || len(warnings) != 1 ||
+		!strings.HasSuffix(warnings[0], "from Load, did you mean server.host?") {
+		t.Errorf("Expected warning from Load, found %v (%v)", warnings, err)
+	}
+}
+
+func Test_knownKeys_strict(t *testing.T) {
+	os.Args = []string{"test", "--server.prot=80"}
+	defer func() { os.Args = []string{} }()
+
+	_, err := NewFlexibleConfiguration(ConfigurationParameters{
+		KnownKeys:  knownKeysTest,
+		StrictKeys: true,
+	})
+	if !errors.Is(err, ErrUnknownProperty) || !strings.Contains(err.Error(),
+		"server.prot from command line argument 1, did you mean server.port?") {
+		t.Errorf("Expected ErrUnknownProperty, found %v", err)
+	}
+
+	os.Args = []string{}
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		KnownKeys:  knownKeysTest,
+		StrictKeys: true,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	err = cfg.(ExtendedConfig).Load(strings.NewReader("server.port: 1\nother: x\n"),
+		ConfigurationFormatYAML)
+	if !errors.Is(err, ErrUnknownProperty) || cfg.Exists("server.port") {
+		t.Errorf("Expected Load of unknown property to fail, found %v", err)
+	}
+}
+
+func Test_knownKeys_suggest(t *testing.T) {
+	tests := []struct {
+		key        string
+		suggestion string
+	}{
+		{"databse.host", "database.host"},
+		{"server.hots", "server.host"},
+		{"completely.different", ""},
+		{"database", ""},
+	}
+
+	for _, test := range tests {
+		suggestion := suggestKey(knownKeysTest, test.key)
+		if suggestion != test.suggestion {
+			t.Errorf("%s: expected '%s', found '%s'", test.key,
+				test.suggestion, suggestion)
+		}
+	}
+
+	if editDistance("kitten", "sitting") != 3 || editDistance("", "ab") != 2 {
+		t.Errorf("Unexpected edit distance")
+	}
+}
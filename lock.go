@@ -0,0 +1,226 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrPropertyLocked indicates an attempt to change a property that
+	// has been locked.
+	ErrPropertyLocked = errors.New("Property is locked")
+
+	// ErrConfigurationFrozen indicates an attempt to change a property
+	// after the configuration has been frozen.
+	ErrConfigurationFrozen = errors.New("Configuration is frozen")
+
+	// ErrConfigurationNotSupported indicates a configuration given to
+	// NewLockedFlexConfigStore was not created by NewFlexibleConfiguration.
+	ErrConfigurationNotSupported = errors.New(
+		"Configuration not created by NewFlexibleConfiguration")
+)
+
+// Lock prevents the properties with the specified keys from being changed.
+// Entries may be patterns, such as "security.*", where * matches any
+// sequence of characters, including dots. Set and Load return
+// ErrPropertyLocked for a locked property, and the value of a locked
+// property is taken from the memory store only, so that writes made to the
+// configuration store by other processes do not change it. Writes made
+// directly to the configuration store are not checked unless it is wrapped
+// using NewLockedFlexConfigStore.
+func (fc *flexibleConfiguration) Lock(keys ...string) {
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if len(k) > 0 {
+			fc.locked = append(fc.locked, k)
+		}
+	}
+}
+
+// IsLocked returns whether the specified property has been locked, either
+// by calling Lock or by the ConfigurationParameters.
+func (fc *flexibleConfiguration) IsLocked(key string) bool {
+	k := strings.TrimSpace(key)
+	if len(k) == 0 {
+		return false
+	}
+
+	return matchesKeyPattern(fc.locked, k)
+}
+
+// Freeze prevents every property from being changed. Once frozen, Set and
+// Load return ErrConfigurationFrozen, and values are no longer read from the
+// configuration store. A configuration cannot be unfrozen.
+func (fc *flexibleConfiguration) Freeze() {
+	fc.frozen = true
+}
+
+// checkWritable returns an error if the property cannot be changed.
+func (fc *flexibleConfiguration) checkWritable(k string) error {
+	if fc.frozen {
+		return ErrConfigurationFrozen
+	}
+
+	if fc.IsLocked(k) {
+		return fmt.Errorf("%w: %s", ErrPropertyLocked, k)
+	}
+
+	return nil
+}
+
+// checkAllWritable returns an error naming the first property, in key
+// order, that cannot be changed.
+func (fc *flexibleConfiguration) checkAllWritable(vars map[string]string) error {
+	if fc.frozen {
+		return ErrConfigurationFrozen
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := fc.checkWritable(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// useStore returns whether the configuration store is consulted for the
+// value of a property. Once the configuration is frozen, values are taken
+// from the memory store only, except in a snapshot, whose store holds the
+// values read when it was taken.
+func (fc *flexibleConfiguration) useStore(k string) bool {
+	if fc.frozen && fc.snapshotOf == nil {
+		return false
+	}
+
+	return fc.store != nil && !fc.IsLocked(k)
+}
+
+// lockedStore is a FlexConfigStore rejecting writes to the properties that
+// cannot be changed in a configuration.
+type lockedStore struct {
+	store FlexConfigStore
+	fc    *flexibleConfiguration
+}
+
+// NewLockedFlexConfigStore returns a FlexConfigStore that writes to store
+// only the properties that can be changed in the configuration, so that code
+// given the store cannot change a property the configuration has locked.
+// Set and Delete return ErrPropertyLocked for a locked property, or
+// ErrConfigurationFrozen once the configuration is frozen, and a delete is
+// rejected if any property it would remove is locked. Reads are not
+// restricted. Writes made to the store by other processes are not affected,
+// and are ignored by the configuration for locked properties. The
+// configuration must have been created by NewFlexibleConfiguration, or
+// ErrConfigurationNotSupported is returned.
+func NewLockedFlexConfigStore(
+	store FlexConfigStore,
+	cfg ExtendedConfig) (FlexConfigStore, error) {
+	fc, ok := cfg.(*flexibleConfiguration)
+	if !ok {
+		return nil, ErrConfigurationNotSupported
+	}
+
+	ls := new(lockedStore)
+	ls.store = store
+	ls.fc = fc
+
+	return ls, nil
+}
+
+// Get returns a property value from the underlying store.
+func (ls *lockedStore) Get(key string) (string, error) {
+	return ls.store.Get(key)
+}
+
+// GetAll returns all properties in the underlying store.
+func (ls *lockedStore) GetAll() ([]KeyValue, error) {
+	return ls.store.GetAll()
+}
+
+// Set writes the property to the underlying store if it is not locked.
+func (ls *lockedStore) Set(key, val string) error {
+	err := ls.fc.checkWritable(strings.TrimSpace(key))
+	if err != nil {
+		return err
+	}
+
+	return ls.store.Set(key, val)
+}
+
+// Delete removes the property, and the properties below it, from the
+// underlying store if none of them is locked.
+func (ls *lockedStore) Delete(key string) error {
+	k := strings.TrimSpace(key)
+	err := ls.fc.checkWritable(k)
+	if err != nil {
+		return err
+	}
+
+	kvs, err := ls.store.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range kvs {
+		if strings.HasPrefix(kv.Key, k+".") {
+			err = ls.fc.checkWritable(kv.Key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return ls.store.Delete(key)
+}
+
+// ApplyBatch applies the batch to the underlying store if none of the
+// properties it sets or deletes is locked. The batch is applied atomically
+// only if the underlying store implements FlexConfigStoreBatcher; otherwise
+// each change is made, and checked, by Set or Delete.
+func (ls *lockedStore) ApplyBatch(expected, desired map[string]string) error {
+	batcher, ok := ls.store.(FlexConfigStoreBatcher)
+	if !ok {
+		return applyChanges(ls, expected, desired)
+	}
+
+	for _, k := range sortedKeys(desired) {
+		err := ls.fc.checkWritable(strings.TrimSpace(k))
+		if err != nil {
+			return err
+		}
+	}
+
+	return batcher.ApplyBatch(expected, desired)
+}
+
+// GetPrefix returns the prefix of the underlying store.
+func (ls *lockedStore) GetPrefix() string {
+	return ls.store.GetPrefix()
+}
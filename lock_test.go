@@ -0,0 +1,205 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_lock_set(t *testing.T) {
+	os.Args = []string{}
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		LockedKeys: []string{"security.*"},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	err = cfg.Set("security.tls.enabled", "false")
+	if !errors.Is(err, ErrPropertyLocked) ||
+		!strings.Contains(err.Error(), "security.tls.enabled") {
+		t.Errorf("Expected ErrPropertyLocked naming key, found %v", err)
+	}
+
+	if cfg.Exists("security.tls.enabled") {
+		t.Errorf("Expected locked property not to be set")
+	}
+
+	err = cfg.Set("app.name", "test")
+	if err != nil || cfg.Get("app.name") != "test" {
+		t.Errorf("Expected unlocked property to be set, found %v", err)
+	}
+
+	cfg.(ExtendedConfig).Lock("app.name")
+	if !cfg.(ExtendedConfig).IsLocked("app.name") ||
+		cfg.(ExtendedConfig).IsLocked("app.other") {
+		t.Errorf("Unexpected result from IsLocked")
+	}
+
+	if !errors.Is(cfg.Set("app.name", "changed"), ErrPropertyLocked) ||
+		cfg.Get("app.name") != "test" {
+		t.Errorf("Expected app.name to be locked")
+	}
+
+	if cfg.Set("bad name", "x") != ErrPropertyNameNotValid {
+		t.Errorf("Expected ErrPropertyNameNotValid")
+	}
+
+	err = cfg.(ExtendedConfig).Load(
+		strings.NewReader("app.other: x\nsecurity.level: 0\n"),
+		ConfigurationFormatYAML)
+	if !errors.Is(err, ErrPropertyLocked) || cfg.Exists("app.other") {
+		t.Errorf("Expected Load of locked property to fail, found %v", err)
+	}
+}
+
+func Test_lock_freeze(t *testing.T) {
+	os.Args = []string{}
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("a.b", "before")
+	cfg.(ExtendedConfig).Freeze()
+
+	if cfg.Set("a.b", "after") != ErrConfigurationFrozen ||
+		cfg.Get("a.b") != "before" {
+		t.Errorf("Expected frozen configuration not to change")
+	}
+
+	err = cfg.(ExtendedConfig).Load(strings.NewReader("c.d: x\n"),
+		ConfigurationFormatYAML)
+	if err != ErrConfigurationFrozen {
+		t.Errorf("Expected ErrConfigurationFrozen from Load, found %v", err)
+	}
+}
+
+func Test_lock_commandLineAndStore(t *testing.T) {
+	os.Args = []string{"test", "--pinned.value=fromCommandLine"}
+	defer func() { os.Args = []string{} }()
+
+	store := newMemStore("")
+	store.Set("pinned.value", "fromStore")
+	store.Set("other.value", "fromStore")
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		LockCommandLineArguments: true,
+		ConfigurationStore:       store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if cfg.Get("pinned.value") != "fromCommandLine" {
+		t.Errorf("Expected locked value from command line, found '%s'",
+			cfg.Get("pinned.value"))
+	}
+
+	if cfg.Get("other.value") != "fromStore" {
+		t.Errorf("Expected unlocked value from store, found '%s'",
+			cfg.Get("other.value"))
+	}
+
+	if !errors.Is(cfg.Set("pinned.value", "x"), ErrPropertyLocked) ||
+		store.kvs["pinned.value"] != "fromStore" {
+		t.Errorf("Expected locked property not to be written to store")
+	}
+}
+
+func Test_lock_freezeWithStore(t *testing.T) {
+	os.Args = []string{}
+
+	store := newMemStore("")
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ConfigurationStore: store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("a.b", "before")
+	cfg.(ExtendedConfig).Freeze()
+
+	store.Set("a.b", "after")
+	store.Set("c.d", "added")
+	if cfg.Get("a.b") != "before" || cfg.Exists("c.d") {
+		t.Errorf("Expected frozen configuration not to read the store: %s",
+			cfg.Get("a.b"))
+	}
+}
+
+func Test_lock_lockedStore(t *testing.T) {
+	os.Args = []string{}
+
+	store := newMemStore("")
+	store.Set("security.level", "high")
+	store.Set("security.mode.strict", "true")
+	store.Set("app.name", "before")
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ConfigurationStore: store,
+		LockedKeys:         []string{"security.level", "security.mode.*"},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	_, err = NewLockedFlexConfigStore(store, struct{ ExtendedConfig }{})
+	if !errors.Is(err, ErrConfigurationNotSupported) {
+		t.Errorf("Expected ErrConfigurationNotSupported, found %v", err)
+	}
+
+	locked, err := NewLockedFlexConfigStore(store, cfg.(ExtendedConfig))
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	err = locked.Set("security.level", "low")
+	if !errors.Is(err, ErrPropertyLocked) ||
+		store.kvs["security.level"] != "high" {
+		t.Errorf("Expected ErrPropertyLocked from Set, found %v", err)
+	}
+
+	err = locked.Delete("security.mode")
+	if !errors.Is(err, ErrPropertyLocked) ||
+		store.kvs["security.mode.strict"] != "true" {
+		t.Errorf("Expected ErrPropertyLocked from Delete, found %v", err)
+	}
+
+	err = locked.Set("app.name", "after")
+	if err != nil || store.kvs["app.name"] != "after" {
+		t.Errorf("Unexpected result writing an unlocked property: %v", err)
+	}
+
+	cfg.(ExtendedConfig).Freeze()
+	if locked.Set("app.name", "frozen") != ErrConfigurationFrozen ||
+		locked.Delete("app.name") != ErrConfigurationFrozen {
+		t.Errorf("Expected ErrConfigurationFrozen once frozen")
+	}
+}
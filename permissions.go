@@ -0,0 +1,179 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// FilePermissionPolicy is an enumerated type defining what is done when a
+// configuration file, or the directory containing it, has permissions or an
+// owner that would allow another user to change the configuration.
+type FilePermissionPolicy int
+
+const (
+	// FilePermissionsIgnore is a value of FilePermissionPolicy
+	// indicating that file permissions and owners are not checked. This
+	// is the default.
+	FilePermissionsIgnore FilePermissionPolicy = iota
+
+	// FilePermissionsWarn is a value of FilePermissionPolicy indicating
+	// that a warning is reported for an insecure file or directory, and
+	// the file is still read.
+	FilePermissionsWarn
+
+	// FilePermissionsReject is a value of FilePermissionPolicy indicating
+	// that an insecure file, or the files in an insecure directory, are
+	// not read, and the configuration cannot be created.
+	FilePermissionsReject
+)
+
+const (
+	groupOrWorldWritable   = 0022
+	groupOrWorldAccessible = 0077
+)
+
+var (
+	// ErrFilePermissionsNotSecure indicates a configuration file, or the
+	// directory containing it, is writable by other users or owned by an
+	// unexpected user.
+	ErrFilePermissionsNotSecure = errors.New(
+		"Configuration file permissions not secure")
+)
+
+// String returns the string representation of the FilePermissionPolicy.
+func (fpp FilePermissionPolicy) String() string {
+	switch fpp {
+	case FilePermissionsIgnore:
+		return "ignore"
+	case FilePermissionsWarn:
+		return "warn"
+	case FilePermissionsReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// defaultWarningHandler reports a warning using the standard logger.
+func defaultWarningHandler(warning string) {
+	log.Printf("flexconfig: %s", warning)
+}
+
+// permissionCheck holds the settings used to check configuration files and
+// directories on the local file system, and the first file rejected by the
+// check. A single permissionCheck is shared by every fileOptions used while
+// reading a configuration.
+type permissionCheck struct {
+	policy            FilePermissionPolicy
+	owners            []int
+	sensitivePatterns []string
+	warn              func(warning string)
+	err               error
+}
+
+// allow returns whether the file or directory may be read. An insecure file
+// is reported using the warning handler or recorded as an error, according
+// to the policy. Files holding sensitive properties must in addition not be
+// accessible at all by the group or other users.
+func (pc *permissionCheck) allow(name string, sensitive bool) bool {
+	if pc == nil || pc.policy == FilePermissionsIgnore ||
+		!filePermissionsSupported {
+		return true
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		// A file that cannot be examined will not be read either
+		return true
+	}
+
+	problem := pc.problem(info, sensitive)
+	if len(problem) == 0 {
+		return true
+	}
+
+	if pc.policy == FilePermissionsWarn {
+		pc.warn(fmt.Sprintf("Configuration file %s %s", name, problem))
+		return true
+	}
+
+	if pc.err == nil {
+		pc.err = fmt.Errorf("%w: %s %s", ErrFilePermissionsNotSecure,
+			name, problem)
+	}
+
+	return false
+}
+
+// problem returns a description of what makes a file or directory insecure,
+// or an empty string if it is secure.
+func (pc *permissionCheck) problem(info os.FileInfo, sensitive bool) string {
+	mode := info.Mode().Perm()
+	if mode&groupOrWorldWritable != 0 {
+		return fmt.Sprintf("is writable by group or others (mode %04o)", mode)
+	}
+
+	uid, ok := fileOwner(info)
+	if ok && !pc.ownerAllowed(uid) {
+		return fmt.Sprintf("is owned by unexpected user %d", uid)
+	}
+
+	if sensitive && !info.IsDir() && mode&groupOrWorldAccessible != 0 {
+		return fmt.Sprintf("holds sensitive properties and is "+
+			"accessible by group or others (mode %04o)", mode)
+	}
+
+	return ""
+}
+
+// ownerAllowed returns whether a file may be owned by the user. If no owners
+// were specified, files may be owned by root or by the effective user of the
+// process.
+func (pc *permissionCheck) ownerAllowed(uid int) bool {
+	if len(pc.owners) == 0 {
+		return uid == 0 || uid == os.Geteuid()
+	}
+
+	for _, owner := range pc.owners {
+		if owner == uid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// holdsSensitive returns whether any of the properties read from a file has
+// a key matching the sensitive key patterns.
+func (pc *permissionCheck) holdsSensitive(vars map[string]string) bool {
+	for k := range vars {
+		if pc.isSensitiveKey(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSensitiveKey returns whether a key matches the sensitive key patterns.
+func (pc *permissionCheck) isSensitiveKey(key string) bool {
+	return pc != nil && matchesKeyPattern(pc.sensitivePatterns, key)
+}
@@ -0,0 +1,33 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"os"
+)
+
+// filePermissionsSupported indicates that file modes do not describe which
+// users can change a file on this platform, so permissions are not checked.
+const filePermissionsSupported = false
+
+// fileOwner is not supported on this platform.
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,276 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// writePermissionFile creates a configuration file with the specified mode.
+func writePermissionFile(
+	t *testing.T,
+	name, contents string,
+	mode os.FileMode) {
+	err := ioutil.WriteFile(name, []byte(contents), 0600)
+	if err != nil {
+		t.Errorf("Can't write %s: %v", name, err)
+		return
+	}
+
+	err = os.Chmod(name, mode)
+	if err != nil {
+		t.Errorf("Can't change mode of %s: %v", name, err)
+	}
+}
+
+func Test_permissions_policyString(t *testing.T) {
+	expected := map[FilePermissionPolicy]string{
+		FilePermissionsIgnore:   "ignore",
+		FilePermissionsWarn:     "warn",
+		FilePermissionsReject:   "reject",
+		FilePermissionPolicy(7): "unknown",
+	}
+
+	for p, e := range expected {
+		if p.String() != e {
+			t.Errorf("Expected '%s', found '%s'", e, p.String())
+		}
+	}
+}
+
+func Test_permissions_files(t *testing.T) {
+	if !filePermissionsSupported {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "flexconfigPermissions")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	writePermissionFile(t, dir+"/a.conf", "a.value: fromA\n", 0644)
+	writePermissionFile(t, dir+"/b.conf", "b.value: fromB\n", 0666)
+	writePermissionFile(t, dir+"/c.conf", "c.password: secret\n", 0644)
+	writePermissionFile(t, dir+"/d.conf", "d.password: secret\n", 0600)
+
+	var warnings []string
+	pc := &permissionCheck{
+		policy:            FilePermissionsWarn,
+		sensitivePatterns: []string{"*.password"},
+		warn: func(warning string) {
+			warnings = append(warnings, warning)
+		},
+	}
+
+	vars := make(map[string]string)
+	readFiles(vars, dir, []string{".conf"}, &fileOptions{permissions: pc})
+
+	if len(vars) != 4 {
+		t.Errorf("Expected all files to be read with warnings, found %v",
+			vars)
+	}
+
+	if len(warnings) != 2 ||
+		!strings.Contains(warnings[0], "b.conf is writable") ||
+		!strings.Contains(warnings[1], "c.conf holds sensitive") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	pc = &permissionCheck{
+		policy:            FilePermissionsReject,
+		sensitivePatterns: []string{"*.password"},
+	}
+
+	vars = make(map[string]string)
+	readFiles(vars, dir, []string{".conf"}, &fileOptions{permissions: pc})
+
+	if len(vars) != 2 || vars["a.value"] != "fromA" ||
+		vars["d.password"] != "secret" {
+		t.Errorf("Expected only secure files to be read, found %v", vars)
+	}
+
+	if !errors.Is(pc.err, ErrFilePermissionsNotSecure) ||
+		!strings.Contains(pc.err.Error(), "b.conf") {
+		t.Errorf("Expected error naming b.conf, found %v", pc.err)
+	}
+}
+
+func Test_permissions_directory(t *testing.T) {
+	if !filePermissionsSupported {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "flexconfigPermissions")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	writePermissionFile(t, dir+"/a.conf", "a.value: fromA\n", 0644)
+	os.Chmod(dir, 0777)
+
+	pc := &permissionCheck{policy: FilePermissionsReject}
+	vars := make(map[string]string)
+	readFiles(vars, dir, []string{".conf"}, &fileOptions{permissions: pc})
+
+	if len(vars) != 0 {
+		t.Errorf("Expected no files read from insecure directory: %v", vars)
+	}
+
+	if pc.err == nil || !strings.Contains(pc.err.Error(), dir+" is writable") {
+		t.Errorf("Expected error naming directory, found %v", pc.err)
+	}
+
+	os.Chmod(dir, 0755)
+
+	pc = &permissionCheck{
+		policy: FilePermissionsReject,
+		owners: []int{os.Geteuid() + 1},
+	}
+
+	vars = make(map[string]string)
+	readFiles(vars, dir, []string{".conf"}, &fileOptions{permissions: pc})
+
+	if len(vars) != 0 || pc.err == nil ||
+		!strings.Contains(pc.err.Error(), "owned by unexpected user") {
+		t.Errorf("Expected unexpected owner to be rejected, found %v (%v)",
+			vars, pc.err)
+	}
+
+	pc = &permissionCheck{
+		policy: FilePermissionsReject,
+		owners: []int{os.Geteuid()},
+	}
+
+	vars = make(map[string]string)
+	readFiles(vars, dir, []string{".conf"}, &fileOptions{permissions: pc})
+
+	if vars["a.value"] != "fromA" || pc.err != nil {
+		t.Errorf("Expected file to be read, found %v (%v)", vars, pc.err)
+	}
+}
+
+func Test_permissions_configuration(t *testing.T) {
+	if !filePermissionsSupported {
+		return
+	}
+
+	os.Args = []string{}
+
+	dir, err := ioutil.TempDir("", "flexconfigPermissions")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	writePermissionFile(t, dir+"/app.conf", "app.value: insecure\n", 0646)
+
+	os.Setenv(flexConfigEnvFileLocation, dir+"/app.conf")
+	defer os.Unsetenv(flexConfigEnvFileLocation)
+
+	_, err = NewFlexibleConfiguration(ConfigurationParameters{
+		FilePermissions: FilePermissionsReject,
+	})
+	if !errors.Is(err, ErrFilePermissionsNotSecure) {
+		t.Errorf("Expected ErrFilePermissionsNotSecure, found %v", err)
+	}
+
+	var warnings []string
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		FilePermissions: FilePermissionsWarn,
+		WarningHandler: func(warning string) {
+			warnings = append(warnings, warning)
+		},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if cfg.Get("app.value") != "insecure" || len(warnings) != 1 {
+		t.Errorf("Expected file read with a warning, found '%s' %v",
+			cfg.Get("app.value"), warnings)
+	}
+
+	cfg, err = NewFlexibleConfiguration(ConfigurationParameters{})
+	if err != nil || cfg.Get("app.value") != "insecure" {
+		t.Errorf("Expected permissions to be ignored by default")
+	}
+}
+
+func Test_permissions_secretFiles(t *testing.T) {
+	if !filePermissionsSupported {
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "flexconfigPermissions")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	writePermissionFile(t, dir+"/db_password", "readable", 0644)
+	writePermissionFile(t, dir+"/db_user", "app", 0644)
+	writePermissionFile(t, dir+"/api_token", "writable", 0666)
+
+	pc := &permissionCheck{
+		policy:            FilePermissionsReject,
+		sensitivePatterns: []string{"*.password"},
+	}
+
+	vars := make(map[string]string)
+	readSecretFiles(vars, make(map[string]string), dir, pc)
+
+	if len(vars) != 1 || vars["db.user"] != "app" || pc.err == nil {
+		t.Errorf("Expected only db.user to be read, found %v (%v)", vars,
+			pc.err)
+	}
+
+	os.Setenv("TEST_PERM_DB_PASSWORD_FILE", dir+"/db_password")
+	os.Setenv("TEST_PERM_DB_USER_FILE", dir+"/db_user")
+	defer os.Unsetenv("TEST_PERM_DB_PASSWORD_FILE")
+	defer os.Unsetenv("TEST_PERM_DB_USER_FILE")
+
+	pc = &permissionCheck{
+		policy:            FilePermissionsReject,
+		sensitivePatterns: []string{"*.password"},
+	}
+
+	vars = make(map[string]string)
+	readEnvVars(vars, make(map[string]string), os.Environ(),
+		[]string{"TEST_PERM_"}, true, pc)
+
+	if len(vars) != 1 || vars["test.perm.db.user"] != "app" ||
+		pc.err == nil ||
+		!strings.Contains(pc.err.Error(), dir+"/db_password") {
+		t.Errorf("Expected sensitive file to be rejected, found %v (%v)",
+			vars, pc.err)
+	}
+}
@@ -0,0 +1,189 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrWriteDenied indicates a write to a configuration store was not
+	// permitted. Errors returned for denied writes are *WriteDeniedError
+	// values, which match ErrWriteDenied using errors.Is.
+	ErrWriteDenied = errors.New("Write denied")
+)
+
+// WriteDeniedError describes a write to a configuration store that was not
+// permitted. Operation is "set" or "delete".
+type WriteDeniedError struct {
+	Identity  string
+	Key       string
+	Operation string
+}
+
+// Error returns a description of the denied write.
+func (e *WriteDeniedError) Error() string {
+	identity := e.Identity
+	if len(identity) == 0 {
+		identity = "anonymous"
+	}
+
+	return fmt.Sprintf("%s: %s may not %s %s", ErrWriteDenied, identity,
+		e.Operation, e.Key)
+}
+
+// Unwrap returns ErrWriteDenied.
+func (e *WriteDeniedError) Unwrap() error {
+	return ErrWriteDenied
+}
+
+// WriteRule permits the identities matching any of Identities to write the
+// properties matching any of Keys. Entries in both lists may be patterns,
+// such as "team-a.*", where * matches any sequence of characters, including
+// dots.
+type WriteRule struct {
+	Identities []string
+	Keys       []string
+}
+
+// policyStruct is a FlexConfigStore restricting writes to another store.
+type policyStruct struct {
+	store    FlexConfigStore
+	identity string
+	rules    []WriteRule
+}
+
+// NewPolicyFlexConfigStore returns a FlexConfigStore that writes to store
+// on behalf of the specified identity, permitting only the writes allowed by
+// the rules. Writes not allowed by any rule return a *WriteDeniedError.
+// Reads are not restricted. Since deleting a property also deletes the
+// properties below it, a delete is permitted only if every property it
+// would remove may be written.
+func NewPolicyFlexConfigStore(
+	store FlexConfigStore,
+	identity string,
+	rules []WriteRule) FlexConfigStore {
+	ps := new(policyStruct)
+	ps.store = store
+	ps.identity = identity
+	ps.rules = rules
+
+	return ps
+}
+
+// Get returns a property value from the underlying store.
+func (ps *policyStruct) Get(key string) (string, error) {
+	return ps.store.Get(key)
+}
+
+// GetAll returns all properties in the underlying store.
+func (ps *policyStruct) GetAll() ([]KeyValue, error) {
+	return ps.store.GetAll()
+}
+
+// Set writes the property to the underlying store if the identity may
+// write it.
+func (ps *policyStruct) Set(key, val string) error {
+	if len(key) == 0 {
+		return ErrStoreKeyRequired
+	}
+
+	k := strings.TrimSpace(key)
+	if !ps.allowed(k) {
+		return &WriteDeniedError{Identity: ps.identity, Key: k,
+			Operation: "set"}
+	}
+
+	return ps.store.Set(key, val)
+}
+
+// Delete removes the property, and the properties below it, from the
+// underlying store if the identity may write all of them.
+func (ps *policyStruct) Delete(key string) error {
+	if len(key) == 0 {
+		return ErrStoreKeyRequired
+	}
+
+	k := strings.TrimSpace(key)
+	if !ps.allowed(k) {
+		return &WriteDeniedError{Identity: ps.identity, Key: k,
+			Operation: "delete"}
+	}
+
+	kvs, err := ps.store.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range kvs {
+		if strings.HasPrefix(kv.Key, k+".") && !ps.allowed(kv.Key) {
+			return &WriteDeniedError{Identity: ps.identity, Key: kv.Key,
+				Operation: "delete"}
+		}
+	}
+
+	return ps.store.Delete(key)
+}
+
+// ApplyBatch applies the batch to the underlying store if the identity may
+// write every property it sets or deletes. The batch is applied atomically
+// only if the underlying store implements FlexConfigStoreBatcher; otherwise
+// each change is made, and checked, by Set or Delete.
+func (ps *policyStruct) ApplyBatch(expected, desired map[string]string) error {
+	batcher, ok := ps.store.(FlexConfigStoreBatcher)
+	if !ok {
+		return applyChanges(ps, expected, desired)
+	}
+
+	for _, key := range sortedKeys(desired) {
+		if len(key) == 0 {
+			return ErrStoreKeyRequired
+		}
+
+		k := strings.TrimSpace(key)
+		if !ps.allowed(k) {
+			operation := "set"
+			if len(desired[key]) == 0 {
+				operation = "delete"
+			}
+
+			return &WriteDeniedError{Identity: ps.identity, Key: k,
+				Operation: operation}
+		}
+	}
+
+	return batcher.ApplyBatch(expected, desired)
+}
+
+// GetPrefix returns the prefix of the underlying store.
+func (ps *policyStruct) GetPrefix() string {
+	return ps.store.GetPrefix()
+}
+
+// allowed returns whether a rule permits the identity to write the property.
+func (ps *policyStruct) allowed(k string) bool {
+	for _, r := range ps.rules {
+		if matchesKeyPattern(r.Identities, ps.identity) &&
+			matchesKeyPattern(r.Keys, k) {
+			return true
+		}
+	}
+
+	return false
+}
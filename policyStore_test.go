@@ -0,0 +1,185 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+)
+
+var policyTestRules = []WriteRule{
+	{Identities: []string{"team-a"}, Keys: []string{"team-a.*"}},
+	{Identities: []string{"admin-*"}, Keys: []string{"*"}},
+	{Identities: []string{"*"}, Keys: []string{"shared.flag"}},
+}
+
+func Test_policyStore_set(t *testing.T) {
+	backing := newMemStore("/shared")
+
+	tests := []struct {
+		identity string
+		key      string
+		allowed  bool
+	}{
+		{"team-a", "team-a.db.host", true},
+		{"team-a", "team-b.db.host", false},
+		{"team-b", "team-a.db.host", false},
+		{"admin-jo", "team-b.db.host", true},
+		{"", "shared.flag", true},
+		{"", "team-a.x", false},
+	}
+
+	for _, test := range tests {
+		store := NewPolicyFlexConfigStore(backing, test.identity,
+			policyTestRules)
+
+		err := store.Set(test.key, "value")
+		if test.allowed && err != nil {
+			t.Errorf("%s setting %s: unexpected error %v",
+				test.identity, test.key, err)
+		}
+
+		if !test.allowed {
+			var denied *WriteDeniedError
+			if !errors.As(err, &denied) || !errors.Is(err, ErrWriteDenied) {
+				t.Errorf("%s setting %s: expected WriteDeniedError, "+
+					"found %v", test.identity, test.key, err)
+				continue
+			}
+
+			if denied.Identity != test.identity ||
+				denied.Key != test.key || denied.Operation != "set" {
+				t.Errorf("Unexpected WriteDeniedError: %+v", denied)
+			}
+		}
+	}
+
+	store := NewPolicyFlexConfigStore(backing, "team-b", policyTestRules)
+	val, err := store.Get("team-a.db.host")
+	if err != nil || val != "value" {
+		t.Errorf("Expected reads not to be restricted, found '%s'", val)
+	}
+
+	if store.GetPrefix() != "/shared" {
+		t.Errorf("Expected prefix of underlying store")
+	}
+
+	err = store.Set("", "x")
+	if err != ErrStoreKeyRequired {
+		t.Errorf("Expected ErrStoreKeyRequired, found %v", err)
+	}
+}
+
+func Test_policyStore_delete(t *testing.T) {
+	backing := newMemStore("")
+	backing.Set("team-a.db.host", "a")
+	backing.Set("team-a.db.port", "1")
+	backing.Set("team-b.db.host", "b")
+
+	store := NewPolicyFlexConfigStore(backing, "team-a", []WriteRule{
+		{Identities: []string{"team-a"}, Keys: []string{"team-a.db.host"}},
+	})
+
+	err := store.Delete("team-b.db.host")
+	if !errors.Is(err, ErrWriteDenied) {
+		t.Errorf("Expected delete of team-b.db.host to be denied")
+	}
+
+	// Deleting team-a.db would also delete team-a.db.port
+	store = NewPolicyFlexConfigStore(backing, "team-a", []WriteRule{
+		{Identities: []string{"team-a"},
+			Keys: []string{"team-a.db", "team-a.db.host"}},
+	})
+
+	err = store.Delete("team-a.db")
+	var denied *WriteDeniedError
+	if !errors.As(err, &denied) || denied.Key != "team-a.db.port" ||
+		denied.Operation != "delete" {
+		t.Errorf("Expected delete to be denied for team-a.db.port, "+
+			"found %v", err)
+	}
+
+	err = store.Delete("team-a.db.host")
+	if err != nil || backing.kvs["team-a.db.host"] != "" {
+		t.Errorf("Expected team-a.db.host to be deleted, found %v", err)
+	}
+
+	// Deleting a leaves ab.c, which merely shares its first characters
+	backing.Set("a", "1")
+	backing.Set("ab.c", "2")
+	store = NewPolicyFlexConfigStore(backing, "team-a", []WriteRule{
+		{Identities: []string{"team-a"}, Keys: []string{"a", "a.*"}},
+	})
+
+	err = store.Delete("a")
+	if err != nil || backing.kvs["a"] != "" || backing.kvs["ab.c"] != "2" {
+		t.Errorf("Expected only a to be deleted: %v (%v)", backing.kvs, err)
+	}
+}
+
+func Test_policyStore_configuration(t *testing.T) {
+	os.Args = []string{}
+
+	backing := newMemStore("")
+	store := NewPolicyFlexConfigStore(backing, "team-a", policyTestRules)
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ConfigurationStore: store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if cfg.Set("team-a.level", "1") != nil {
+		t.Errorf("Expected write to team-a.level to be permitted")
+	}
+
+	err = cfg.Set("team-b.level", "1")
+	if !errors.Is(err, ErrWriteDenied) {
+		t.Errorf("Expected Set to return WriteDeniedError, found %v", err)
+	}
+
+	if len(backing.kvs) != 1 {
+		t.Errorf("Expected only one property in store, found %v",
+			backing.kvs)
+	}
+}
+
+func Test_policyStore_etcdWriteError(t *testing.T) {
+	err := etcdWriteError(rpctypes.ErrPermissionDenied, "svc", "a.b", "set")
+
+	var denied *WriteDeniedError
+	if !errors.As(err, &denied) || denied.Identity != "svc" ||
+		denied.Key != "a.b" {
+		t.Errorf("Expected WriteDeniedError, found %v", err)
+	}
+
+	other := errors.New("other")
+	if etcdWriteError(other, "svc", "a.b", "set") != other {
+		t.Errorf("Expected other errors to be returned unchanged")
+	}
+
+	_, err = NewAuthenticatedFlexConfigStore(FlexConfigStoreUnknown, nil, "",
+		StoreCredentials{})
+	if err != ErrStoreUnsupportedType {
+		t.Errorf("Expected ErrStoreUnsupportedType, found %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Provenance describes where a value of a property was defined. Layer is
+// one of "default configuration", "configuration file", "secret file",
+// "environment variables", "command line arguments", "configuration store",
+// "Set", or "Load". Path is the file, URL, or secret file the value was read
+// from, or the prefix of the configuration store, and Line is the line of
+// the file on which the property is defined, or 0 if it is not known.
+// EnvVar is the name of the environment variable, and Argument the index in
+// os.Args of the command line argument, that set the value. The value of a
+// sensitive property is replaced by RedactedValue.
+type Provenance struct {
+	Layer    string
+	Path     string
+	Line     int
+	EnvVar   string
+	Argument int
+	Value    string
+}
+
+// String returns a description of where the value was defined.
+func (p Provenance) String() string {
+	switch p.Layer {
+	case sourceDefault, sourceFile, sourceSecret:
+		location := p.Path
+		if p.Line > 0 {
+			location += ":" + strconv.Itoa(p.Line)
+		}
+
+		if p.Layer == sourceDefault {
+			return sourceDefault + " " + location
+		}
+
+		return location
+	case sourceEnvironment:
+		if len(p.EnvVar) > 0 {
+			return "environment variable " + p.EnvVar
+		}
+	case sourceCommandLine:
+		if p.Argument > 0 {
+			return "command line argument " + strconv.Itoa(p.Argument)
+		}
+	}
+
+	return p.Layer
+}
+
+// Explain describes where the value of the specified property in the
+// global configuration came from. If the global configuration does not
+// exist (no call has been made to NewFlexibleConfiguration), an empty
+// configuration is created.
+func Explain(key string) []Provenance {
+	cfg := GetConfiguration().(ExtendedConfig)
+	return cfg.Explain(key)
+}
+
+// Explain describes where the value of the specified property came from.
+// The first element describes the source of the current value, and is
+// followed by the values it overrides, in order of decreasing priority. A
+// value in the configuration store overrides all others. If the property has
+// no value and a deprecated key aliased to it does, the values of the
+// deprecated key are described. Nothing is returned if the property has
+// never been set.
+func (fc *flexibleConfiguration) Explain(key string) []Provenance {
+	k := strings.TrimSpace(key)
+	if len(k) == 0 {
+		return nil
+	}
+
+	from, val, fromStore := fc.lookupValue(k)
+
+	var chain []Provenance
+	if fromStore {
+		chain = append(chain, Provenance{Layer: sourceStore,
+			Path: fc.store.GetPrefix(), Value: val})
+	}
+
+	recorded := fc.sources[from]
+	for i := len(recorded) - 1; i >= 0; i-- {
+		chain = append(chain, recorded[i])
+	}
+
+	for i := range chain {
+		chain[i].Value = fc.redact(from, fc.redact(k, chain[i].Value))
+	}
+
+	return chain
+}
+
+// recordProvenance adds the source of a new value of a property to the
+// values it overrides.
+func recordProvenance(sources map[string][]Provenance, k string, p Provenance) {
+	sources[k] = append(sources[k], p)
+}
+
+// currentProvenance returns the source of the current value of a property
+// in the memory store, and whether it is known.
+func currentProvenance(sources map[string][]Provenance, k string) (Provenance, bool) {
+	recorded := sources[k]
+	if len(recorded) == 0 {
+		return Provenance{}, false
+	}
+
+	return recorded[len(recorded)-1], true
+}
+
+// propertyLine returns the line, counting from 1, on which a property
+// appears to be defined in the contents of a configuration file, or 0 if it
+// cannot be found. The properties format defines a key on a single line,
+// while the other formats define each component of the key in turn, so the
+// full key is searched for first and then each of its components. Components
+// that cannot be found, such as an INI name prefix or an array index, are
+// skipped.
+func propertyLine(contents, key string) int {
+	lines := strings.Split(contents, "\n")
+	n := lineDefining(lines, 0, key)
+	if n >= 0 {
+		return n + 1
+	}
+
+	line := 0
+	start := 0
+	for _, c := range strings.Split(key, ".") {
+		n = lineDefining(lines, start, c)
+		if n >= 0 {
+			line = n + 1
+			start = n + 1
+		}
+	}
+
+	return line
+}
+
+// lineDefining returns the index of the first line, at or after start, that
+// begins with the name followed by a separator, ignoring indentation,
+// quotes, and INI section brackets, or -1 if there is none.
+func lineDefining(lines []string, start int, name string) int {
+	for i := start; i < len(lines); i++ {
+		l := strings.ToLower(strings.TrimLeft(lines[i], " \t[\"'"))
+		if !strings.HasPrefix(l, name) {
+			continue
+		}
+
+		rest := strings.TrimLeft(l[len(name):], " \t\"'")
+		if len(rest) > 0 && strings.IndexByte(":=]", rest[0]) >= 0 {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,131 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_provenance_explain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigProvenance")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/app.yaml"
+	ioutil.WriteFile(filename, []byte(
+		"# application settings\nserver:\n  port: 8080\n  host: file\n"+
+			"db:\n  password: fromFile\n"), 0600)
+
+	os.Setenv(flexConfigEnvFileLocation, filename)
+	defer os.Unsetenv(flexConfigEnvFileLocation)
+	os.Setenv("SERVER_HOST", "env")
+	defer os.Unsetenv("SERVER_HOST")
+	os.Args = []string{"test", "-v", "--server.host=arg"}
+	defer func() { os.Args = []string{} }()
+
+	store := newMemStore("/app")
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		DefaultConfiguration: fstest.MapFS{
+			"defaults.conf": {Data: []byte("server.host: default\n")},
+		},
+		EnvironmentVariablePrefixes: []string{"SERVER_HOST"},
+		SensitiveKeys:               []string{"*.password"},
+		ConfigurationStore:          store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	expected := []Provenance{
+		{Layer: sourceCommandLine, Argument: 2, Value: "arg"},
+		{Layer: sourceEnvironment, EnvVar: "SERVER_HOST", Value: "env"},
+		{Layer: sourceFile, Path: filename, Line: 4, Value: "file"},
+		{Layer: sourceDefault, Path: "./defaults.conf", Line: 1,
+			Value: "default"},
+	}
+
+	chain := cfg.(ExtendedConfig).Explain("server.host")
+	if len(chain) != len(expected) {
+		t.Errorf("Expected %d values, found %v", len(expected), chain)
+		return
+	}
+
+	for i, p := range expected {
+		if chain[i] != p {
+			t.Errorf("Value %d: expected %+v, found %+v", i, p, chain[i])
+		}
+	}
+
+	if chain[0].String() != "command line argument 2" ||
+		chain[1].String() != "environment variable SERVER_HOST" ||
+		chain[2].String() != filename+":4" {
+		t.Errorf("Unexpected descriptions: %v", chain)
+	}
+
+	chain = cfg.(ExtendedConfig).Explain("server.port")
+	if len(chain) != 1 || chain[0].Line != 3 || chain[0].Value != "8080" {
+		t.Errorf("Unexpected provenance of server.port: %v", chain)
+	}
+
+	chain = cfg.(ExtendedConfig).Explain("db.password")
+	if len(chain) != 1 || chain[0].Value != RedactedValue {
+		t.Errorf("Expected sensitive value to be redacted: %v", chain)
+	}
+
+	cfg.Set("server.port", "9090")
+	store.Set("server.port", "7070")
+	chain = cfg.(ExtendedConfig).Explain("server.port")
+	if len(chain) != 3 || chain[0].Layer != sourceStore ||
+		chain[0].Path != "/app" || chain[1].Layer != sourceSet ||
+		chain[1].Value != "9090" || chain[2].Value != "8080" {
+		t.Errorf("Unexpected provenance after Set: %v", chain)
+	}
+
+	if len(cfg.(ExtendedConfig).Explain("not.set")) != 0 {
+		t.Errorf("Expected no provenance for a property not set")
+	}
+}
+
+func Test_provenance_propertyLine(t *testing.T) {
+	tests := []struct {
+		contents string
+		key      string
+		line     int
+	}{
+		{"a.b=1\nc.d=2\n", "c.d", 2},
+		{"a:\n  b: 1\nc:\n  b: 2\n", "c.b", 4},
+		{"{\n  \"a\": {\n    \"b\": 1\n  }\n}\n", "a.b", 3},
+		{"[section]\nname = x\n", "prefix.section.name", 2},
+		{"a: 1\n", "missing", 0},
+	}
+
+	for _, test := range tests {
+		line := propertyLine(test.contents, test.key)
+		if line != test.line {
+			t.Errorf("%s: expected line %d, found %d", test.key, test.line,
+				line)
+		}
+	}
+}
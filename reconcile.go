@@ -0,0 +1,305 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrStoreChanged indicates a StorePlan was not applied because a
+	// property it changes was changed in the store after the plan was
+	// made.
+	ErrStoreChanged = errors.New("Store changed since the plan was made")
+
+	// ErrDesiredStateConflict indicates a property is given different
+	// values by two files in a desired state directory.
+	ErrDesiredStateConflict = errors.New("Property defined with different values in desired state")
+
+	// ErrDesiredStateEmpty indicates a desired state directory contains no
+	// configuration files.
+	ErrDesiredStateEmpty = errors.New("No configuration files in desired state")
+)
+
+// PlanOptions controls how PlanStore compares a store with its desired state.
+//
+// Prune, if true, plans the deletion of properties in the store that the
+// desired state does not define. Otherwise they are left unchanged.
+//
+// SensitiveKeys lists keys, or patterns as described for SensitiveKeys in
+// ConfigurationParameters, whose values are replaced by RedactedValue in
+// the changes of the plan.
+type PlanOptions struct {
+	Prune         bool
+	SensitiveKeys []string
+}
+
+// StorePlan describes the changes that make the properties in a store match
+// a desired state. Changes lists them in order of key, with the old values
+// from the store and the new values from the desired state.
+type StorePlan struct {
+	Changes []Change
+
+	store    FlexConfigStore
+	expected map[string]string
+	desired  map[string]string
+}
+
+// PlanStore compares the properties in the store with the desired state
+// defined by a YAML, JSON, or INI file, or by every such file in a
+// directory, including files with the suffix ".conf" in any of these
+// formats, and returns the plan of properties to add, update, and, if
+// Prune is set, delete. The files in a directory are read in order of name,
+// and must not give a property different values. A property with an empty
+// value is treated as not defined by the desired state, since a store does
+// not hold empty values. INI files are read with an empty IniNamePrefix.
+// Unlike the files read by NewFlexibleConfiguration, a file that cannot be
+// read or parsed is an error, so that a mistake in the desired state cannot
+// cause properties to be deleted.
+func PlanStore(
+	store FlexConfigStore,
+	path string,
+	opts PlanOptions) (*StorePlan, error) {
+	vars, sources, err := readDesiredState(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := storeProperties(store)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := compareProperties(current, vars, opts.Prune,
+		storeSource(store), func(k string) Provenance {
+			return sources[k]
+		})
+
+	plan := &StorePlan{
+		store:    store,
+		expected: make(map[string]string),
+		desired:  make(map[string]string),
+	}
+	for _, c := range changes {
+		plan.expected[c.Key] = current[c.Key]
+		plan.desired[c.Key] = vars[c.Key]
+	}
+
+	plan.Changes = redactChanges(changes, opts.SensitiveKeys)
+
+	return plan, nil
+}
+
+// Apply makes the changes in the plan. If the store implements
+// FlexConfigStoreBatcher, the changes are made in a single atomic
+// operation. Otherwise they are made one at a time in order of key, and
+// those made before a failure remain. In that case, properties below a
+// deleted property are removed by Delete and then set again. In either case no change is made, and
+// ErrStoreChanged is returned, if a property to be changed no longer has the
+// value it had when the plan was made.
+//
+// The stores returned by NewPolicyFlexConfigStore, NewAuditedFlexConfigStore,
+// NewEncryptedFlexConfigStore, and NewLockedFlexConfigStore implement
+// FlexConfigStoreBatcher, checking, recording, or encrypting the changes as
+// they do for Set and Delete. Their changes are made in a single atomic
+// operation only if the store they wrap implements FlexConfigStoreBatcher.
+func (plan *StorePlan) Apply() error {
+	if len(plan.desired) == 0 {
+		return nil
+	}
+
+	return applyBatch(plan.store, plan.expected, plan.desired)
+}
+
+// applyBatch makes the changes described for FlexConfigStoreBatcher, in a
+// single operation if the store implements it, and otherwise one at a time.
+func applyBatch(store FlexConfigStore, expected, desired map[string]string) error {
+	batcher, ok := store.(FlexConfigStoreBatcher)
+	if ok {
+		return batcher.ApplyBatch(expected, desired)
+	}
+
+	return applyChanges(store, expected, desired)
+}
+
+// applyChanges makes the changes described for FlexConfigStoreBatcher one at
+// a time in order of key, using Set and Delete, once every property in
+// expected has been checked to still have the value given. As Delete also
+// removes the properties below a property, those the batch does not change
+// are set again to their values, so that only the property itself is
+// deleted, as it is by ApplyBatch.
+func applyChanges(store FlexConfigStore, expected, desired map[string]string) error {
+	current, err := storeProperties(store)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range expected {
+		if current[k] != v {
+			return fmt.Errorf("%w: %s", ErrStoreChanged, k)
+		}
+	}
+
+	for _, k := range sortedKeys(desired) {
+		if len(desired[k]) == 0 {
+			err = deleteProperty(store, k, current, desired)
+		} else {
+			err = store.Set(k, desired[k])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteProperty deletes a property from the store without the properties
+// below it, setting those that are not in desired back to their current
+// values. Those in desired are changed later, as their keys follow the key of
+// the property in order.
+func deleteProperty(
+	store FlexConfigStore,
+	key string,
+	current, desired map[string]string) error {
+	err := store.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range sortedKeys(current) {
+		_, changed := desired[k]
+		if changed || !strings.HasPrefix(k, key+".") {
+			continue
+		}
+
+		err = store.Set(k, current[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDesiredState returns the properties defined by a file, or by the
+// files in a directory, together with the file and line defining each.
+// Properties with empty values are left out, as a store does not hold empty
+// values.
+func readDesiredState(
+	path string) (map[string]string, map[string]Provenance, error) {
+	filenames := []string{path}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		filenames, err = desiredStateFiles(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	vars := make(map[string]string)
+	sources := make(map[string]Provenance)
+	for _, filename := range filenames {
+		fileContents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fileVars := make(map[string]string)
+		err = parseConfigContents(fileVars, configFormatFromName(filename),
+			string(fileContents), "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filename, err)
+		}
+
+		for k, v := range fileVars {
+			previous, exists := vars[k]
+			if exists && previous != v {
+				return nil, nil, fmt.Errorf("%w: %s in %s and %s",
+					ErrDesiredStateConflict, k, sources[k].Path, filename)
+			}
+
+			vars[k] = v
+			sources[k] = fileSource(filename, string(fileContents))(k)
+		}
+	}
+
+	for k, v := range vars {
+		if len(v) == 0 {
+			delete(vars, k)
+			delete(sources, k)
+		}
+	}
+
+	return vars, sources, nil
+}
+
+// desiredStateFiles returns the configuration files in a directory, in
+// order of name: those whose names imply their format, and those with the
+// suffix ".conf", whose format is detected from their contents. Entries
+// that are not regular files, such as directories, are skipped.
+func desiredStateFiles(dirname string) ([]string, error) {
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+
+	var filenames []string
+	for _, name := range names {
+		if configFormatFromName(name) == ConfigurationFormatUnknown &&
+			!strings.HasSuffix(name, defaultConfigurationSuffix) {
+			continue
+		}
+
+		filename := filepath.Join(dirname, name)
+		info, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Mode().IsRegular() {
+			filenames = append(filenames, filename)
+		}
+	}
+
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDesiredStateEmpty, dirname)
+	}
+
+	return filenames, nil
+}
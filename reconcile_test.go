@@ -0,0 +1,315 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// batchStore is a memStore that applies batches atomically, counting them.
+type batchStore struct {
+	*memStore
+	batches int
+}
+
+func (bs *batchStore) ApplyBatch(expected, desired map[string]string) error {
+	for k, v := range expected {
+		if bs.kvs[k] != v {
+			return ErrStoreChanged
+		}
+	}
+
+	for k, v := range desired {
+		if len(v) == 0 {
+			delete(bs.kvs, k)
+		} else {
+			bs.kvs[k] = v
+		}
+	}
+
+	bs.batches++
+	return nil
+}
+
+func Test_reconcile_plan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigReconcile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/10-log.yaml", []byte("log:\n  level: info\n"), 0600)
+	ioutil.WriteFile(dir+"/20-db.ini", []byte("[db]\nhost = primary\n"+
+		"password = secret\n"), 0600)
+	ioutil.WriteFile(dir+"/30-app.conf", []byte("app:\n  name: main\n"), 0600)
+	ioutil.WriteFile(dir+"/README.md", []byte("# Not configuration\n"), 0600)
+	os.Mkdir(dir+"/40-archive.yaml", 0700)
+
+	store := newMemStore("/example")
+	store.Set("log.level", "debug")
+	store.Set("db.host", "primary")
+	store.Set("stale", "old")
+
+	plan, err := PlanStore(store, dir,
+		PlanOptions{SensitiveKeys: []string{"*.password"}})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	WriteDiff(&buf, plan.Changes)
+	expected := "+ app.name = main (" + dir + "/30-app.conf:2)\n" +
+		"+ db.password = ******** (" + dir + "/20-db.ini:3)\n" +
+		"~ log.level = debug (configuration store) -> info (" + dir +
+		"/10-log.yaml:2)\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected plan:\n%s", buf.String())
+	}
+
+	plan, _ = PlanStore(store, dir, PlanOptions{Prune: true})
+	if len(plan.Changes) != 4 || plan.Changes[3].Type != ChangeRemoved ||
+		plan.Changes[3].Key != "stale" {
+		t.Errorf("Expected pruning to remove stale: %v", plan.Changes)
+	}
+
+	if len(store.kvs) != 3 || store.kvs["log.level"] != "debug" {
+		t.Errorf("Expected planning not to change the store: %v", store.kvs)
+	}
+
+	err = plan.Apply()
+	if err != nil || len(store.kvs) != 4 || store.kvs["log.level"] != "info" ||
+		store.kvs["db.password"] != "secret" || store.kvs["stale"] != "" {
+		t.Errorf("Unexpected store after apply: %v (%v)", store.kvs, err)
+	}
+
+	plan, _ = PlanStore(store, dir, PlanOptions{Prune: true})
+	if len(plan.Changes) != 0 || plan.Apply() != nil {
+		t.Errorf("Expected an empty plan once applied: %v", plan.Changes)
+	}
+}
+
+func Test_reconcile_apply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigReconcile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/desired.json"
+	ioutil.WriteFile(filename, []byte("{\"a\": \"1\", \"b\": \"2\"}"), 0600)
+
+	store := &batchStore{memStore: newMemStore("/example")}
+	store.Set("a", "0")
+	store.Set("c", "3")
+
+	plan, err := PlanStore(store, filename, PlanOptions{Prune: true})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	err = plan.Apply()
+	if err != nil || store.batches != 1 || len(store.kvs) != 2 ||
+		store.kvs["a"] != "1" || store.kvs["b"] != "2" {
+		t.Errorf("Expected a single batch: %d %v (%v)", store.batches,
+			store.kvs, err)
+	}
+
+	// A change made after planning prevents the plan being applied
+	plain := newMemStore("/example")
+	plain.Set("a", "0")
+	plan, _ = PlanStore(plain, filename, PlanOptions{})
+	plain.Set("b", "9")
+	if !errors.Is(plan.Apply(), ErrStoreChanged) || plain.kvs["a"] != "0" {
+		t.Errorf("Expected ErrStoreChanged without changes: %v", plain.kvs)
+	}
+
+	store.Set("a", "5")
+	plan, _ = PlanStore(store, filename, PlanOptions{})
+	store.Set("a", "6")
+	if plan.Apply() != ErrStoreChanged || store.kvs["a"] != "6" {
+		t.Errorf("Expected ErrStoreChanged from batch: %v", store.kvs)
+	}
+}
+
+func Test_reconcile_emptyValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigReconcile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/desired.yaml"
+	ioutil.WriteFile(filename, []byte("a: \"\"\nb: x\n"), 0600)
+
+	store := newMemStore("/example")
+
+	plan, err := PlanStore(store, filename, PlanOptions{})
+	if err != nil || len(plan.Changes) != 1 || plan.Changes[0].Key != "b" {
+		t.Errorf("Expected only b to be added: %v (%v)", plan.Changes, err)
+		return
+	}
+
+	err = plan.Apply()
+	if err != nil {
+		t.Errorf("Unexpected error applying plan: %v", err)
+	}
+
+	plan, _ = PlanStore(store, filename, PlanOptions{Prune: true})
+	if len(plan.Changes) != 0 {
+		t.Errorf("Expected an empty plan once applied: %v", plan.Changes)
+	}
+}
+
+func Test_reconcile_deleteParent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigReconcile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/desired.yaml"
+	ioutil.WriteFile(filename, []byte("log:\n  level: info\n"), 0600)
+
+	store := newMemStore("/example")
+	store.Set("log", "enabled")
+	store.Set("log.level", "info")
+	store.Set("log.file", "app.log")
+
+	plan, err := PlanStore(store, filename, PlanOptions{Prune: true})
+	if err != nil || len(plan.Changes) != 2 {
+		t.Errorf("Expected log and log.file to be removed: %v (%v)",
+			plan.Changes, err)
+		return
+	}
+
+	err = plan.Apply()
+	if err != nil || len(store.kvs) != 1 || store.kvs["log.level"] != "info" {
+		t.Errorf("Expected only log.level to remain: %v (%v)", store.kvs, err)
+	}
+}
+
+func Test_reconcile_desiredStateErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigReconcile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	store := newMemStore("/example")
+	_, err = PlanStore(store, dir, PlanOptions{Prune: true})
+	if !errors.Is(err, ErrDesiredStateEmpty) {
+		t.Errorf("Expected ErrDesiredStateEmpty, found %v", err)
+	}
+
+	ioutil.WriteFile(dir+"/a.yaml", []byte("log:\n  level: info\n"), 0600)
+	ioutil.WriteFile(dir+"/b.json", []byte("{\"log\": {\"level\": \"warn\"}}"),
+		0600)
+	_, err = PlanStore(store, dir, PlanOptions{})
+	if !errors.Is(err, ErrDesiredStateConflict) {
+		t.Errorf("Expected ErrDesiredStateConflict, found %v", err)
+	}
+
+	ioutil.WriteFile(dir+"/b.json", []byte("{\"log\": "), 0600)
+	_, err = PlanStore(store, dir, PlanOptions{})
+	if err == nil {
+		t.Errorf("Expected an error for a file that cannot be parsed")
+	}
+}
+
+func Test_reconcile_applyWrapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigReconcile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/desired.json"
+	ioutil.WriteFile(filename, []byte("{\"team\": {\"a\": \"1\"}}"), 0600)
+
+	backing := &batchStore{memStore: newMemStore("/example")}
+	backing.Set("team.b", "0")
+
+	sink := &memAuditSink{}
+	key := StoreKey{ID: "k1", Key: bytes.Repeat([]byte{1}, 32)}
+	encrypted, _ := NewEncryptedFlexConfigStore(backing, key)
+	policy := NewPolicyFlexConfigStore(encrypted, "team", []WriteRule{
+		{Identities: []string{"team"}, Keys: []string{"team.*"}},
+	})
+	store := NewAuditedFlexConfigStore(policy, sink, "team", nil)
+
+	plan, err := PlanStore(store, filename, PlanOptions{Prune: true})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	err = plan.Apply()
+	a, _ := encrypted.Get("team.a")
+	if err != nil || backing.batches != 1 || len(backing.kvs) != 1 ||
+		a != "1" || backing.kvs["team.a"] == "1" {
+		t.Errorf("Expected a single encrypted batch: %d %v (%v)",
+			backing.batches, backing.kvs, err)
+	}
+
+	if len(sink.events) != 2 || sink.events[0].Key != "team.a" ||
+		sink.events[1].Operation != "delete" ||
+		sink.events[1].OldValue != "0" {
+		t.Errorf("Unexpected audit events: %v", sink.events)
+	}
+
+	// The expected value is compared with the decrypted value
+	ioutil.WriteFile(filename, []byte("{\"team\": {\"a\": \"2\"}}"), 0600)
+	plan, _ = PlanStore(store, filename, PlanOptions{})
+	encrypted.Set("team.a", "3")
+	if !errors.Is(plan.Apply(), ErrStoreChanged) || backing.batches != 1 {
+		t.Errorf("Expected ErrStoreChanged from encrypted batch")
+	}
+
+	// A change denied by the policy prevents the whole batch
+	ioutil.WriteFile(filename, []byte("{\"team\": {\"a\": \"4\"}, "+
+		"\"other\": \"x\"}"), 0600)
+	plan, _ = PlanStore(store, filename, PlanOptions{})
+	if !errors.Is(plan.Apply(), ErrWriteDenied) || backing.batches != 1 {
+		t.Errorf("Expected ErrWriteDenied from batch")
+	}
+
+	// Without a batcher below, changes are made through Set and Delete
+	plain := newMemStore("/example")
+	plan, _ = PlanStore(NewPolicyFlexConfigStore(plain, "team", nil),
+		filename, PlanOptions{})
+	if !errors.Is(plan.Apply(), ErrWriteDenied) || len(plain.kvs) != 0 {
+		t.Errorf("Expected ErrWriteDenied without a batcher: %v", plain.kvs)
+	}
+}
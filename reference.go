@@ -0,0 +1,245 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ReferenceFormat is an enumerated type defining the format of the
+// reference documentation written by WriteReference.
+type ReferenceFormat int
+
+const (
+	// ReferenceFormatUnknown is a value of ReferenceFormat indicating the
+	// format is unknown.
+	ReferenceFormatUnknown ReferenceFormat = iota
+
+	// ReferenceFormatMarkdown is a value of ReferenceFormat indicating the
+	// reference is written as Markdown.
+	ReferenceFormatMarkdown
+
+	// ReferenceFormatMan is a value of ReferenceFormat indicating the
+	// reference is written as a man page.
+	ReferenceFormatMan
+
+	// ReferenceFormatText is a value of ReferenceFormat indicating the
+	// reference is written as plain text, suitable for help output.
+	ReferenceFormatText
+)
+
+var (
+	// ErrReferenceFormatNotValid indicates the ReferenceFormat passed to
+	// WriteReference is not supported.
+	ErrReferenceFormatNotValid = errors.New("Reference format not valid")
+)
+
+// KeyDoc documents a property the application uses. Type describes the
+// values accepted, such as "int" or "duration", Default describes the value
+// the application uses when the property is not set, and Example is an
+// example value. The fields are documentation only: Default is not applied
+// to the configuration, so Get returns an empty string for a property that
+// is not set. Defaults to be applied can be provided using
+// DefaultConfiguration in the ConfigurationParameters.
+type KeyDoc struct {
+	Key         string
+	Description string
+	Type        string
+	Default     string
+	Example     string
+}
+
+// keyReference is the information written for a property in the reference.
+type keyReference struct {
+	KeyDoc
+	envVar     string
+	sensitive  bool
+	deprecated []string
+}
+
+// WriteReference writes reference documentation for every property
+// documented by the KeyDocs in the ConfigurationParameters, in order of
+// key. Besides the KeyDoc, the reference names the environment variable
+// that sets the property, if it has one of the EnvironmentVariablePrefixes,
+// and the deprecated keys aliased to it, and notes whether the property is
+// sensitive.
+func (fc *flexibleConfiguration) WriteReference(
+	w io.Writer,
+	format ReferenceFormat) error {
+	refs := make([]keyReference, 0, len(fc.keyDocs))
+	for _, doc := range fc.keyDocs {
+		refs = append(refs, keyReference{
+			KeyDoc:     doc,
+			envVar:     fc.referenceEnvVar(doc.Key),
+			sensitive:  fc.IsSensitive(doc.Key),
+			deprecated: fc.aliasesOf(doc.Key),
+		})
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Key < refs[j].Key
+	})
+
+	bw := bufio.NewWriter(w)
+	switch format {
+	case ReferenceFormatMarkdown:
+		writeMarkdownReference(bw, fc.appName, refs)
+	case ReferenceFormatMan:
+		writeManReference(bw, fc.appName, refs)
+	case ReferenceFormatText:
+		writeTextReference(bw, refs)
+	default:
+		return ErrReferenceFormatNotValid
+	}
+
+	return bw.Flush()
+}
+
+// referenceEnvVar returns the name of the environment variable that sets the
+// property, or an empty string if environment variables are not read for it.
+func (fc *flexibleConfiguration) referenceEnvVar(k string) string {
+	if strings.Contains(k, "-") {
+		return ""
+	}
+
+	name := envVarNameForKey(k)
+	for _, prefix := range fc.envPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// details returns the labelled details of the property, other than its
+// description, in the order they are written.
+func (ref keyReference) details() [][2]string {
+	var details [][2]string
+	add := func(label, value string) {
+		if len(value) > 0 {
+			details = append(details, [2]string{label, value})
+		}
+	}
+
+	add("Type", ref.Type)
+	add("Default", ref.Default)
+	add("Example", ref.Example)
+	add("Environment variable", ref.envVar)
+	add("Deprecated keys", strings.Join(ref.deprecated, ", "))
+	if ref.sensitive {
+		add("Sensitive", "yes")
+	}
+
+	return details
+}
+
+// writeMarkdownReference writes the reference as Markdown, with a section
+// for each property.
+func writeMarkdownReference(w *bufio.Writer, appName string, refs []keyReference) {
+	w.WriteString("# " + strings.TrimSpace(appName+" configuration") +
+		" reference\n")
+	for _, ref := range refs {
+		w.WriteString("\n## `" + ref.Key + "`\n")
+		if len(ref.Description) > 0 {
+			w.WriteString("\n" + ref.Description + "\n")
+		}
+
+		details := ref.details()
+		if len(details) > 0 {
+			w.WriteString("\n")
+		}
+
+		for _, d := range details {
+			w.WriteString("- " + d[0] + ": `" + d[1] + "`\n")
+		}
+	}
+}
+
+// writeManReference writes the reference as a man page in section 5, the
+// section for file formats.
+func writeManReference(w *bufio.Writer, appName string, refs []keyReference) {
+	name := appName
+	if len(name) == 0 {
+		name = "configuration"
+	}
+
+	w.WriteString(".TH " + manEscape(strings.ToUpper(name)) + " 5\n")
+	w.WriteString(".SH NAME\n" + manEscape(name) +
+		" \\- configuration properties\n")
+	w.WriteString(".SH PROPERTIES\n")
+	for _, ref := range refs {
+		w.WriteString(".TP\n.B " + manEscape(ref.Key) + "\n")
+		if len(ref.Description) > 0 {
+			w.WriteString(manEscape(ref.Description) + "\n")
+		}
+
+		for _, d := range ref.details() {
+			w.WriteString(".br\n" + d[0] + ": " + manEscape(d[1]) + "\n")
+		}
+	}
+}
+
+// writeTextReference writes the reference as indented plain text.
+func writeTextReference(w *bufio.Writer, refs []keyReference) {
+	for i, ref := range refs {
+		if i > 0 {
+			w.WriteString("\n")
+		}
+
+		w.WriteString(ref.Key + "\n")
+		if len(ref.Description) > 0 {
+			w.WriteString("    " + ref.Description + "\n")
+		}
+
+		for _, d := range ref.details() {
+			w.WriteString("    " + d[0] + ": " + d[1] + "\n")
+		}
+	}
+}
+
+// manEscape escapes text for a man page, so that backslashes are shown and
+// lines starting with a period or quote are not taken as requests.
+func manEscape(text string) string {
+	text = strings.Replace(text, "\\", "\\e", -1)
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = "\\&" + l
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// String returns the string representation of the ReferenceFormat.
+func (rf ReferenceFormat) String() string {
+	switch rf {
+	case ReferenceFormatMarkdown:
+		return "markdown"
+	case ReferenceFormatMan:
+		return "man"
+	case ReferenceFormatText:
+		return "text"
+	default:
+		return "unknown"
+	}
+}
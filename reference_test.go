@@ -0,0 +1,120 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+var referenceTestDocs = []KeyDoc{
+	{Key: "server.port", Description: "Port the server listens on.",
+		Type: "int", Default: "8080", Example: "9090"},
+	{Key: "db.password", Description: "Password for the database.",
+		Type: "string"},
+	{Key: "db.url", Description: ".Leading period and \\backslash"},
+}
+
+func newReferenceTestConfig(t *testing.T) Config {
+	os.Args = []string{"test", "--server.prot=1"}
+	defer func() { os.Args = []string{} }()
+
+	var warnings []string
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName:             "refApp",
+		EnvironmentVariablePrefixes: []string{"SERVER_"},
+		SensitiveKeys:               []string{"*.password"},
+		KeyAliases:                  map[string]string{"http.port": "server.port"},
+		KeyDocs:                     referenceTestDocs,
+		WarningHandler: func(warning string) {
+			warnings = append(warnings, warning)
+		},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return nil
+	}
+
+	if len(warnings) != 1 ||
+		!strings.HasSuffix(warnings[0], "did you mean server.port?") {
+		t.Errorf("Expected documented keys to be known: %v", warnings)
+	}
+
+	return cfg
+}
+
+func Test_reference_markdown(t *testing.T) {
+	cfg := newReferenceTestConfig(t)
+	if cfg == nil {
+		return
+	}
+
+	var b bytes.Buffer
+	err := cfg.(ExtendedConfig).WriteReference(&b, ReferenceFormatMarkdown)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	expected := "# refApp configuration reference\n" +
+		"\n## `db.password`\n\nPassword for the database.\n\n" +
+		"- Type: `string`\n- Sensitive: `yes`\n" +
+		"\n## `db.url`\n\n.Leading period and \\backslash\n" +
+		"\n## `server.port`\n\nPort the server listens on.\n\n" +
+		"- Type: `int`\n- Default: `8080`\n- Example: `9090`\n" +
+		"- Environment variable: `SERVER_PORT`\n" +
+		"- Deprecated keys: `http.port`\n"
+	if b.String() != expected {
+		t.Errorf("Unexpected Markdown:\n%s", b.String())
+	}
+}
+
+func Test_reference_manAndText(t *testing.T) {
+	cfg := newReferenceTestConfig(t)
+	if cfg == nil {
+		return
+	}
+
+	var b bytes.Buffer
+	cfg.(ExtendedConfig).WriteReference(&b, ReferenceFormatMan)
+	man := b.String()
+	if !strings.HasPrefix(man, ".TH REFAPP 5\n.SH NAME\nrefApp \\- ") ||
+		!strings.Contains(man, ".TP\n.B db.url\n\\&.Leading period and "+
+			"\\ebackslash\n") ||
+		!strings.Contains(man, ".br\nDefault: 8080\n") {
+		t.Errorf("Unexpected man page:\n%s", man)
+	}
+
+	b.Reset()
+	cfg.(ExtendedConfig).WriteReference(&b, ReferenceFormatText)
+	if !strings.Contains(b.String(), "\nserver.port\n"+
+		"    Port the server listens on.\n    Type: int\n") {
+		t.Errorf("Unexpected text:\n%s", b.String())
+	}
+
+	if cfg.(ExtendedConfig).WriteReference(&b, ReferenceFormatUnknown) !=
+		ErrReferenceFormatNotValid {
+		t.Errorf("Expected ErrReferenceFormatNotValid")
+	}
+
+	if ReferenceFormatMan.String() != "man" ||
+		ReferenceFormat(42).String() != "unknown" {
+		t.Errorf("Unexpected ReferenceFormat names")
+	}
+}
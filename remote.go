@@ -0,0 +1,349 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	remoteRequestTimeoutMs = 5000
+	remoteMaxContentLength = 16 * 1024 * 1024
+	remoteCacheSubdir      = "flexconfig"
+)
+
+// remoteCacheEntry describes a configuration document that was fetched from
+// a URL and saved on disk. The validators are sent with the next request so
+// the server can answer with 304 Not Modified when the document is unchanged.
+type remoteCacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+}
+
+// isRemoteLocation returns whether a configuration file location is an
+// http or https URL rather than a path on the local file system.
+func isRemoteLocation(location string) bool {
+	return strings.HasPrefix(location, "http://") ||
+		strings.HasPrefix(location, "https://")
+}
+
+// defaultRemoteCacheDirectory returns the directory used to cache remote
+// configuration documents when none is specified in the
+// ConfigurationParameters.
+func defaultRemoteCacheDirectory() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, remoteCacheSubdir)
+}
+
+// readRemoteConfigFile fetches a configuration document from a URL and
+// creates configuration properties based on its contents. A copy of the
+// document, and of its signature when signatures are checked, is kept in the
+// cache directory of the options. The cached copy is used when the server
+// reports that the document has not been modified, and when the server
+// cannot be reached or returns an error. The signature is only fetched again
+// when a new version of the document is fetched, or when none is cached.
+func readRemoteConfigFile(
+	vars map[string]string,
+	location string,
+	opts *fileOptions) {
+	entry, body, sig := loadRemoteCache(opts.cacheDir, location)
+
+	newEntry, newBody, err := fetchRemoteConfig(location, entry)
+	if err == nil && newEntry != nil {
+		entry = newEntry
+		body = newBody
+		sig = nil
+		if opts.signatures.enabled() {
+			sig = fetchRemoteSignature(location)
+		}
+
+		saveRemoteCache(opts.cacheDir, entry, body, sig)
+	} else if entry != nil && sig == nil && opts.signatures.enabled() {
+		sig = fetchRemoteSignature(location)
+		if sig != nil {
+			saveRemoteCache(opts.cacheDir, entry, body, sig)
+		}
+	}
+
+	if entry == nil || body == nil {
+		return
+	}
+
+	if !opts.signatures.allow(location, body, func() ([]byte, error) {
+		if sig == nil {
+			return nil, ErrSignatureMissing
+		}
+
+		return sig, nil
+	}) {
+		return
+	}
+
+	name := remotePath(location)
+	suffix := compressionSuffix(name)
+	if len(suffix) > 0 {
+		var err error
+		body, err = decompress(body, suffix, opts.maxDecompressedSize)
+		if err != nil {
+			return
+		}
+	}
+
+	format := configFormatFromContentType(entry.ContentType)
+	if format == ConfigurationFormatUnknown {
+		format = configFormatFromName(uncompressedName(name))
+	}
+
+	remoteVars := make(map[string]string)
+	parseConfigContents(remoteVars, format, string(body), opts.iniPrefix)
+	opts.merge(vars, remoteVars, location, string(body))
+}
+
+// fetchRemoteConfig requests a configuration document from a URL. If a
+// cached entry is specified, its validators are sent with the request and a
+// nil entry is returned when the server reports the document is unchanged.
+func fetchRemoteConfig(
+	location string,
+	cached *remoteCacheEntry) (*remoteCacheEntry, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cached != nil {
+		if len(cached.ETag) > 0 {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		if len(cached.LastModified) > 0 {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	client := http.Client{
+		Timeout: time.Duration(remoteRequestTimeoutMs) * time.Millisecond,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return nil, nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Unexpected status fetching %s: %s",
+			location, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body,
+		remoteMaxContentLength+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(body) > remoteMaxContentLength {
+		return nil, nil, fmt.Errorf("Configuration at %s is too large",
+			location)
+	}
+
+	entry := &remoteCacheEntry{
+		URL:          location,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+	}
+
+	return entry, body, nil
+}
+
+// remoteCachePath returns the path, without suffix, of the files caching
+// the document fetched from a URL.
+func remoteCachePath(cacheDir, location string) string {
+	sum := sha256.Sum256([]byte(location))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// fetchRemoteSignature fetches the detached signature of the document at a
+// URL. Nil is returned if the signature cannot be fetched.
+func fetchRemoteSignature(location string) []byte {
+	sigLocation, err := remoteSignatureLocation(location)
+	if err != nil {
+		return nil
+	}
+
+	_, sig, err := fetchRemoteConfig(sigLocation, nil)
+	if err != nil {
+		return nil
+	}
+
+	return sig
+}
+
+// remoteSignatureLocation returns the URL of the detached signature of the
+// document at a URL. The signature suffix is appended to the path, so any
+// query or fragment of the URL is kept as is.
+func remoteSignatureLocation(location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path += signatureSuffix
+	if len(u.RawPath) > 0 {
+		u.RawPath += signatureSuffix
+	}
+
+	return u.String(), nil
+}
+
+// loadRemoteCache returns the cached entry, document and signature for a URL.
+// If there is no usable cached copy, nil is returned for all of them. The
+// signature is nil when none was cached with the document.
+func loadRemoteCache(
+	cacheDir, location string) (*remoteCacheEntry, []byte, []byte) {
+	if len(cacheDir) == 0 {
+		return nil, nil, nil
+	}
+
+	path := remoteCachePath(cacheDir, location)
+
+	meta, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	entry := new(remoteCacheEntry)
+	err = json.Unmarshal(meta, entry)
+	if err != nil || entry.URL != location {
+		return nil, nil, nil
+	}
+
+	body, err := ioutil.ReadFile(path + ".body")
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	sig, err := ioutil.ReadFile(path + signatureSuffix)
+	if err != nil {
+		sig = nil
+	}
+
+	return entry, body, sig
+}
+
+// saveRemoteCache saves a fetched document, its signature and its validators
+// in the cache directory. A nil signature removes any signature cached for a
+// previous version of the document. Failure to save the cached copy is not an
+// error, it only means the document will not be available if the server
+// becomes unreachable.
+func saveRemoteCache(
+	cacheDir string,
+	entry *remoteCacheEntry,
+	body []byte,
+	sig []byte) {
+	if len(cacheDir) == 0 {
+		return
+	}
+
+	err := os.MkdirAll(cacheDir, 0700)
+	if err != nil {
+		return
+	}
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	path := remoteCachePath(cacheDir, entry.URL)
+
+	if sig != nil {
+		err = ioutil.WriteFile(path+signatureSuffix, sig, 0600)
+	} else {
+		err = os.Remove(path + signatureSuffix)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = ioutil.WriteFile(path+".body", body, 0600)
+	if err != nil {
+		return
+	}
+
+	ioutil.WriteFile(path+".json", meta, 0600)
+}
+
+// configFormatFromContentType returns the format of a configuration document
+// indicated by the Content-Type returned by a server. Generic content types,
+// such as text/plain, result in ConfigurationFormatUnknown.
+func configFormatFromContentType(contentType string) ConfigurationFormat {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ConfigurationFormatUnknown
+	}
+
+	switch {
+	case mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json"):
+		return ConfigurationFormatJSON
+	case strings.HasSuffix(mediaType, "yaml"):
+		return ConfigurationFormatYAML
+	case mediaType == "text/x-ini" || mediaType == "application/x-ini":
+		return ConfigurationFormatINI
+	default:
+		return ConfigurationFormatUnknown
+	}
+}
+
+// remotePath returns the path portion of a URL, used to find the format of
+// a document from the suffix of its name.
+func remotePath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+
+	return u.Path
+}
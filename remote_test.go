@@ -0,0 +1,203 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func Test_remote_fetchAndCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "flexconfigCache")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(cacheDir)
+
+	requests := 0
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"test.remote.one": "from server"}`))
+		}))
+
+	location := server.URL + "/app.conf"
+
+	v := make(map[string]string)
+	readSingleConfigFile(v, location, &fileOptions{cacheDir: cacheDir})
+	if v["test.remote.one"] != "from server" {
+		t.Errorf("Unexpected value: %s", v["test.remote.one"])
+	}
+
+	v = make(map[string]string)
+	readSingleConfigFile(v, location, &fileOptions{cacheDir: cacheDir})
+	if v["test.remote.one"] != "from server" {
+		t.Errorf("Unexpected value from cache: %s", v["test.remote.one"])
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Errorf("Unexpected requests: %d, not modified: %d",
+			requests, notModified)
+	}
+
+	server.Close()
+
+	v = make(map[string]string)
+	readSingleConfigFile(v, location, &fileOptions{cacheDir: cacheDir})
+	if v["test.remote.one"] != "from server" {
+		t.Errorf("Cache not used for unreachable server: %v", v)
+	}
+}
+
+func Test_remote_signatureCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "flexconfigCache")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(cacheDir)
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	contents := []byte(`{"test.remote.signed": "yes"}`)
+
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests[r.URL.RequestURI()]++
+			if r.URL.Query().Get("env") != "prod" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			switch r.URL.Path {
+			case "/app.conf":
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				w.Header().Set("ETag", `"v1"`)
+				w.Write(contents)
+			case "/app.conf.sig":
+				w.Write(ed25519.Sign(priv, contents))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+	location := server.URL + "/app.conf?env=prod"
+
+	read := func() (map[string]string, error) {
+		sc := &signatureCheck{
+			policy: SignaturesFail,
+			keys:   []TrustedKey{{Key: pub}},
+		}
+
+		v := make(map[string]string)
+		readSingleConfigFile(v, location,
+			&fileOptions{cacheDir: cacheDir, signatures: sc})
+		return v, sc.err
+	}
+
+	for i := 0; i < 2; i++ {
+		v, err := read()
+		if err != nil || v["test.remote.signed"] != "yes" {
+			t.Errorf("Read %d: unexpected properties %v (%v)", i, v, err)
+		}
+	}
+
+	if requests["/app.conf?env=prod"] != 2 ||
+		requests["/app.conf.sig?env=prod"] != 1 {
+		t.Errorf("Unexpected requests: %v", requests)
+	}
+
+	server.Close()
+
+	v, err := read()
+	if err != nil || v["test.remote.signed"] != "yes" {
+		t.Errorf("Cached signature not used for unreachable server: %v (%v)",
+			v, err)
+	}
+}
+
+func Test_remote_iniByExtension(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("[section1]\nname=section1-name\n"))
+		}))
+	defer server.Close()
+
+	v := make(map[string]string)
+	readSingleConfigFile(v, server.URL+"/app.ini", &fileOptions{iniPrefix: "test"})
+	if v["test.section1.name"] != "section1-name" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+}
+
+func Test_remote_errorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "missing", http.StatusNotFound)
+		}))
+	defer server.Close()
+
+	v := make(map[string]string)
+	readSingleConfigFile(v, server.URL+"/app.conf", &fileOptions{})
+	if len(v) > 0 {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+}
+
+func Test_remote_formats(t *testing.T) {
+	if configFormatFromContentType("application/json; charset=utf-8") !=
+		ConfigurationFormatJSON {
+		t.Errorf("JSON content type not recognized")
+	}
+
+	if configFormatFromContentType("application/x-yaml") != ConfigurationFormatYAML {
+		t.Errorf("YAML content type not recognized")
+	}
+
+	if configFormatFromContentType("text/plain") != ConfigurationFormatUnknown {
+		t.Errorf("Generic content type recognized")
+	}
+
+	if !isRemoteLocation("https://example.com/app.conf") {
+		t.Errorf("URL not recognized")
+	}
+
+	if isRemoteLocation("/etc/app/app.conf") {
+		t.Errorf("Path recognized as URL")
+	}
+}
@@ -0,0 +1,168 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	referenceSchemeSeparator = ":"
+)
+
+// Resolver produces a value for a reference of the form ${<scheme>:<ref>}
+// in a property value. A Resolver is registered for a scheme by calling
+// RegisterResolver, and is passed <ref> when a property containing the
+// reference is retrieved.
+type Resolver interface {
+	// Resolve returns the value for the reference. An empty value
+	// causes the default in ${<scheme>:<ref>:-<default>} to be used.
+	Resolve(ref string) (string, error)
+}
+
+// ResolverFunc is an adapter allowing an ordinary function to be used as a
+// Resolver.
+type ResolverFunc func(ref string) (string, error)
+
+// Resolve calls f(ref).
+func (f ResolverFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	resolversLock sync.RWMutex
+	resolvers     = map[string]Resolver{
+		"env":    ResolverFunc(resolveEnv),
+		"file":   SensitiveResolver(ResolverFunc(resolveFile)),
+		"base64": ResolverFunc(resolveBase64),
+	}
+)
+
+// RegisterResolver makes a Resolver available for references using the
+// specified scheme. The schemes "env" (the value of an environment variable),
+// "file" (the contents of a file, which is treated as sensitive), and
+// "base64" (the decoding of base64 data) are registered by default.
+// Registering a scheme a second time replaces the previous Resolver, and a
+// nil Resolver removes the scheme.
+func RegisterResolver(scheme string, r Resolver) {
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+
+	if r == nil {
+		delete(resolvers, scheme)
+		return
+	}
+
+	resolvers[scheme] = r
+}
+
+// lookupResolver returns the Resolver registered for a scheme, or nil if the
+// scheme is not registered.
+func lookupResolver(scheme string) Resolver {
+	resolversLock.RLock()
+	defer resolversLock.RUnlock()
+
+	return resolvers[scheme]
+}
+
+// splitSchemeReference splits the expression of a reference into a scheme
+// and the reference passed to the Resolver for the scheme. Property keys
+// cannot contain a colon, so any expression containing one names a scheme.
+func splitSchemeReference(expr string) (string, string, bool) {
+	index := strings.Index(expr, referenceSchemeSeparator)
+	if index <= 0 {
+		return "", "", false
+	}
+
+	return expr[:index], expr[index+len(referenceSchemeSeparator):], true
+}
+
+// resolverCache holds the values produced by Resolvers, so that each
+// reference is resolved at most once for each configuration that is read.
+type resolverCache struct {
+	lock   sync.Mutex
+	values map[string]string
+}
+
+// newResolverCache returns an empty resolverCache.
+func newResolverCache() *resolverCache {
+	return &resolverCache{values: make(map[string]string)}
+}
+
+// resolve returns the cached value for the scheme and reference, calling
+// the Resolver if there is no cached value. Errors are not cached, so a
+// failed resolution is retried the next time the property is retrieved.
+func (rc *resolverCache) resolve(
+	r Resolver,
+	scheme, ref string) (string, error) {
+	if rc == nil || cachesValues(r) {
+		return r.Resolve(ref)
+	}
+
+	cacheKey := scheme + referenceSchemeSeparator + ref
+
+	rc.lock.Lock()
+	val, exists := rc.values[cacheKey]
+	rc.lock.Unlock()
+
+	if exists {
+		return val, nil
+	}
+
+	val, err := r.Resolve(ref)
+	if err != nil {
+		return "", err
+	}
+
+	rc.lock.Lock()
+	rc.values[cacheKey] = val
+	rc.lock.Unlock()
+
+	return val, nil
+}
+
+// cachesValues returns whether a Resolver caches its own values, in which
+// case its values are not kept in a resolverCache. A Resolver returning
+// values that expire, such as leased secrets, does this.
+func cachesValues(r Resolver) bool {
+	c, ok := r.(interface{ CachesValues() bool })
+	return ok && c.CachesValues()
+}
+
+// resolveEnv resolves ${env:NAME} to the value of the environment variable.
+func resolveEnv(ref string) (string, error) {
+	return os.Getenv(ref), nil
+}
+
+// resolveFile resolves ${file:/path} to the contents of the file, without
+// trailing line endings.
+func resolveFile(ref string) (string, error) {
+	return readSecretFile(ref)
+}
+
+// resolveBase64 resolves ${base64:data} to the decoding of the data.
+func resolveBase64(ref string) (string, error) {
+	val, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return string(val), nil
+}
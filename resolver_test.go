@@ -0,0 +1,190 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_resolver_builtin(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigResolver")
+	if err != nil {
+		t.Errorf("Can't create temporary file")
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("from file\n")
+	f.Close()
+
+	os.Setenv("TEST_RESOLVER_VAR", "from env")
+	defer os.Unsetenv("TEST_RESOLVER_VAR")
+
+	vars := map[string]string{
+		"env":     "${env:TEST_RESOLVER_VAR}",
+		"unset":   "${env:TEST_RESOLVER_UNSET:-fallback}",
+		"file":    "${file:" + f.Name() + "}",
+		"base64":  "${base64:aGVsbG8=}",
+		"unknown": "${nosuchscheme:abc}",
+	}
+
+	expected := map[string]string{
+		"env":     "from env",
+		"unset":   "fallback",
+		"file":    "from file",
+		"base64":  "hello",
+		"unknown": "${nosuchscheme:abc}",
+	}
+
+	for k, e := range expected {
+		ip := newInterpolator(func(key string) string { return vars[key] })
+		ip.resolvers = lookupResolver
+
+		val, err := ip.resolveProperty(k, vars[k])
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %v", k, err)
+		}
+
+		if val != e {
+			t.Errorf("Unexpected value for %s: %s", k, val)
+		}
+	}
+}
+
+func Test_resolver_registerAndCache(t *testing.T) {
+	calls := 0
+	RegisterResolver("count", ResolverFunc(func(ref string) (string, error) {
+		calls++
+		return strings.ToUpper(ref), nil
+	}))
+	defer RegisterResolver("count", nil)
+
+	cache := newResolverCache()
+	for i := 0; i < 3; i++ {
+		ip := newInterpolator(func(key string) string { return "" })
+		ip.resolvers = lookupResolver
+		ip.cache = cache
+
+		val, err := ip.resolveProperty("k", "${count:abc}")
+		if err != nil || val != "ABC" {
+			t.Errorf("Unexpected result: %s %v", val, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Resolver not cached, called %d times", calls)
+	}
+
+	if lookupResolver("count") == nil {
+		t.Errorf("Registered resolver not found")
+	}
+
+	RegisterResolver("count", nil)
+	if lookupResolver("count") != nil {
+		t.Errorf("Removed resolver found")
+	}
+}
+
+func Test_resolver_configuration(t *testing.T) {
+	os.Args = []string{}
+	fsys := fstest.MapFS{
+		"etc/resApp/app.conf": {Data: []byte(
+			"db:\n  password: ${file:/nonexistent/flexconfig/secret}\n" +
+				"  user: ${base64:YXBw}\n  dsn: ${db.user}:${db.password}\n")},
+	}
+
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "resApp",
+		FileSystem:      fsys,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if c.Get("db.user") != "app" {
+		t.Errorf("Unexpected value: %s", c.Get("db.user"))
+	}
+
+	_, err = c.(ExtendedConfig).Lookup("db.dsn")
+	if err == nil {
+		t.Errorf("Unexpected success resolving missing file")
+		return
+	}
+
+	if !strings.Contains(err.Error(), "property db.password from /etc/resApp/app.conf") {
+		t.Errorf("Error does not name property and source: %v", err)
+	}
+
+	var pathErr *os.PathError
+	if !errors.As(err, &pathErr) {
+		t.Errorf("Error does not wrap the resolver error: %v", err)
+	}
+
+	if c.Get("db.password") != "${file:/nonexistent/flexconfig/secret}" {
+		t.Errorf("Unexpected value: %s", c.Get("db.password"))
+	}
+}
+
+func Test_resolver_storeValues(t *testing.T) {
+	os.Args = []string{}
+	fsys := fstest.MapFS{
+		"etc/resStoreApp/app.conf": {Data: []byte("app:\n  user: ${base64:YXBw}\n")},
+	}
+
+	store := newMemStore("/example")
+	store.Set("app.leak", "${base64:c2VjcmV0}")
+	store.Set("app.name", "${app.user}-${app.missing:-${base64:eA==}}")
+
+	params := ConfigurationParameters{
+		ApplicationName:    "resStoreApp",
+		FileSystem:         fsys,
+		ConfigurationStore: store,
+	}
+
+	c, err := NewFlexibleConfiguration(params)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if c.Get("app.leak") != "${base64:c2VjcmV0}" {
+		t.Errorf("Resolver used for store value: %s", c.Get("app.leak"))
+	}
+
+	if c.Get("app.name") != "app-${base64:eA==}" {
+		t.Errorf("Unexpected value: %s", c.Get("app.name"))
+	}
+
+	params.ResolveStoreValues = true
+	c, err = NewFlexibleConfiguration(params)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if c.Get("app.leak") != "secret" || c.Get("app.name") != "app-x" {
+		t.Errorf("Expected resolvers for store values: %s %s",
+			c.Get("app.leak"), c.Get("app.name"))
+	}
+}
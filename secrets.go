@@ -0,0 +1,125 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	dockerSecretsDirectory       = "/run/secrets"
+	systemdCredentialsEnvVarName = "CREDENTIALS_DIRECTORY"
+)
+
+// readSecretDirectories reads the secret directories enabled in the
+// configuration parameters: the Docker secrets directory and the systemd
+// credentials directory named by $CREDENTIALS_DIRECTORY. The file from which
+// each property was read is recorded in sources, and every property read is
+// marked as sensitive. Directories and files rejected by the permission check
+// are not read.
+func readSecretDirectories(
+	vars map[string]string,
+	sources map[string][]Provenance,
+	sensitive map[string]bool,
+	dockerSecrets, systemdCredentials bool,
+	permissions *permissionCheck) {
+	dirs := []string{}
+	if dockerSecrets {
+		dirs = append(dirs, dockerSecretsDirectory)
+	}
+
+	if systemdCredentials {
+		dir := os.Getenv(systemdCredentialsEnvVarName)
+		if len(dir) > 0 {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		secretVars := make(map[string]string)
+		paths := make(map[string]string)
+		readSecretFiles(secretVars, paths, dir, permissions)
+		mergeProperties(vars, secretVars, sources, func(k string) Provenance {
+			return Provenance{Layer: sourceSecret, Path: paths[k]}
+		})
+
+		for k := range secretVars {
+			sensitive[k] = true
+		}
+	}
+}
+
+// readSecretFiles reads every regular file in a single directory, where each
+// file holds the value of one property, recording the path of the file from
+// which each property was read in paths. The property key is derived from
+// the file name in the same way environment variable names are converted, so
+// both "db_password" and "db.password" result in the key "db.password".
+// Hidden files and subdirectories are skipped, which excludes the bookkeeping
+// entries created by some container runtimes. The directory and each file are
+// checked as configuration files are, a file being treated as holding
+// sensitive properties if its key matches the sensitive key patterns.
+func readSecretFiles(
+	vars, paths map[string]string,
+	dirname string,
+	permissions *permissionCheck) {
+	if !permissions.allow(dirname, false) {
+		return
+	}
+
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return
+	}
+
+	defer dir.Close()
+
+	filenames, err := dir.Readdirnames(0)
+	if err != nil {
+		return
+	}
+
+	sort.Strings(filenames)
+
+	for _, f := range filenames {
+		if strings.HasPrefix(f, ".") {
+			continue
+		}
+
+		path := filepath.Join(dirname, f)
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		key := transformEnvName(f)
+		if !conformsToKey(key) ||
+			!permissions.allow(path, permissions.isSensitiveKey(key)) {
+			continue
+		}
+
+		val, err := readSecretFile(path)
+		if err != nil {
+			continue
+		}
+
+		vars[key] = val
+		paths[key] = path
+	}
+}
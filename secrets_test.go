@@ -0,0 +1,100 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_secrets_files(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigSecrets")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/db_password", []byte("pw1\n"), 0600)
+	ioutil.WriteFile(dir+"/api.token", []byte("tok"), 0600)
+	ioutil.WriteFile(dir+"/.hidden", []byte("hidden"), 0600)
+	os.Mkdir(dir+"/..data", 0700)
+
+	v := make(map[string]string)
+	paths := make(map[string]string)
+	readSecretFiles(v, paths, dir, nil)
+
+	if len(v) != 2 || paths["db.password"] != dir+"/db_password" {
+		t.Errorf("Unexpected properties found: %v %v", v, paths)
+	}
+
+	if v["db.password"] != "pw1" {
+		t.Errorf("Unexpected value: %s", v["db.password"])
+	}
+
+	if v["api.token"] != "tok" {
+		t.Errorf("Unexpected value: %s", v["api.token"])
+	}
+}
+
+func Test_secrets_credentialsDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigCredentials")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(dir+"/db_password", []byte("pw2"), 0600)
+	os.Setenv(systemdCredentialsEnvVarName, dir)
+	defer os.Unsetenv(systemdCredentialsEnvVarName)
+
+	v := make(map[string]string)
+	sources := make(map[string][]Provenance)
+	sensitive := make(map[string]bool)
+	readSecretDirectories(v, sources, sensitive, false, false, nil)
+	if len(v) > 0 {
+		t.Errorf("Unexpected properties found: %v", v)
+	}
+
+	readSecretDirectories(v, sources, sensitive, false, true, nil)
+	if v["db.password"] != "pw2" {
+		t.Errorf("Unexpected value: %s", v["db.password"])
+	}
+
+	source, _ := currentProvenance(sources, "db.password")
+	if source.Path != dir+"/db_password" || source.Layer != sourceSecret {
+		t.Errorf("Unexpected source: %v", source)
+	}
+
+	if !sensitive["db.password"] {
+		t.Errorf("Secret property not marked sensitive")
+	}
+}
+
+func Test_secrets_missingDirectory(t *testing.T) {
+	v := make(map[string]string)
+	readSecretFiles(v, make(map[string]string),
+		"/nonexistent/flexconfig/secrets", nil)
+
+	if len(v) > 0 {
+		t.Errorf("Unexpected properties found: %v", v)
+	}
+}
@@ -0,0 +1,175 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	// RedactedValue replaces the value of a sensitive property wherever
+	// the library reports property values.
+	RedactedValue = "********"
+)
+
+// sensitiveResolver wraps a Resolver whose values are sensitive.
+type sensitiveResolver struct {
+	Resolver
+}
+
+// Sensitive reports that values produced by the Resolver are sensitive.
+func (sr sensitiveResolver) Sensitive() bool {
+	return true
+}
+
+// SensitiveResolver returns a Resolver producing the same values as r, but
+// causing every property referring to it to be treated as sensitive. The
+// built in "file" scheme is registered this way.
+func SensitiveResolver(r Resolver) Resolver {
+	return sensitiveResolver{Resolver: r}
+}
+
+// isSensitiveResolver returns whether a Resolver produces sensitive values.
+func isSensitiveResolver(r Resolver) bool {
+	s, ok := r.(interface{ Sensitive() bool })
+	return ok && s.Sensitive()
+}
+
+// matchesKeyPattern returns whether the key is one of the patterns, or
+// matches one of them using the syntax of path.Match, where * matches any
+// sequence of characters, including dots. For example, "*.password"
+// matches both "db.password" and "app.db.password".
+func matchesKeyPattern(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if p == key {
+			return true
+		}
+
+		matched, err := path.Match(p, key)
+		if err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsSensitive returns whether the value of the specified property must not
+// be revealed. A property is sensitive if its key matches SensitiveKeys in
+// the ConfigurationParameters, if its value was read from a secret source
+// (an encrypted value, a <VAR>_FILE environment variable, or a secret
+// directory), or if its value refers to a sensitive property or to a
+// Resolver created by SensitiveResolver.
+func (fc *flexibleConfiguration) IsSensitive(key string) bool {
+	k := strings.TrimSpace(key)
+	if len(k) == 0 {
+		return false
+	}
+
+	return fc.isSensitive(k, make(map[string]bool), false)
+}
+
+// isSecret returns whether the value of a property was read from a secret
+// source, including a sensitive Resolver, or refers to a property whose
+// value was. Unlike IsSensitive, the SensitiveKeys patterns are not
+// considered.
+func (fc *flexibleConfiguration) isSecret(k string) bool {
+	return fc.isSensitive(k, make(map[string]bool), true)
+}
+
+// isSensitive returns whether a property is sensitive, using visited to
+// avoid following reference cycles. If secretOnly is true, only values
+// read from secret sources, including sensitive Resolvers, are considered
+// sensitive.
+func (fc *flexibleConfiguration) isSensitive(
+	k string,
+	visited map[string]bool,
+	secretOnly bool) bool {
+	if visited[k] {
+		return false
+	}
+
+	visited[k] = true
+
+	if fc.sensitive[k] ||
+		(!secretOnly && matchesKeyPattern(fc.sensitivePatterns, k)) {
+		return true
+	}
+
+	return fc.referencesSensitive(fc.getValue(k), visited, secretOnly)
+}
+
+// referencesSensitive returns whether a value refers to a sensitive property
+// or a sensitive Resolver, including references made in default values.
+func (fc *flexibleConfiguration) referencesSensitive(
+	val string,
+	visited map[string]bool,
+	secretOnly bool) bool {
+	found := false
+	forEachReference(val, func(expr string) bool {
+		key, def, hasDefault := splitReferenceDefault(expr)
+
+		if scheme, _, ok := splitSchemeReference(key); ok {
+			r := lookupResolver(scheme)
+			if r != nil && isSensitiveResolver(r) {
+				found = true
+			}
+		} else if fc.isSensitive(key, visited, secretOnly) {
+			found = true
+		}
+
+		if !found && hasDefault {
+			found = fc.referencesSensitive(def, visited, secretOnly)
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+// redact returns the value, or RedactedValue if the property is sensitive.
+func (fc *flexibleConfiguration) redact(k, val string) string {
+	if fc.IsSensitive(k) {
+		return redactValue(val)
+	}
+
+	return val
+}
+
+// RedactValue returns the value of a property, or RedactedValue in its place
+// if the key matches one of the sensitive keys or patterns, as described for
+// SensitiveKeys in ConfigurationParameters. An empty value is returned as it
+// is.
+func RedactValue(sensitiveKeys []string, key, val string) string {
+	if matchesKeyPattern(sensitiveKeys, key) {
+		return redactValue(val)
+	}
+
+	return val
+}
+
+// redactValue returns RedactedValue, or an empty string if the value is
+// empty, so that a redacted value still shows whether a value was present.
+func redactValue(val string) string {
+	if len(val) == 0 {
+		return ""
+	}
+
+	return RedactedValue
+}
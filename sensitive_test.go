@@ -0,0 +1,150 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_sensitive_patterns(t *testing.T) {
+	patterns := []string{"*.password", "api.token", "secret.*"}
+
+	matches := map[string]bool{
+		"db.password":     true,
+		"app.db.password": true,
+		"password":        false,
+		"api.token":       true,
+		"api.tokens":      false,
+		"secret.anything": true,
+		"db.user":         false,
+	}
+
+	for k, expected := range matches {
+		if matchesKeyPattern(patterns, k) != expected {
+			t.Errorf("Unexpected match result for %s", k)
+		}
+	}
+
+	if RedactValue(patterns, "db.password", "s3cret") != RedactedValue ||
+		RedactValue(patterns, "db.password", "") != "" ||
+		RedactValue(patterns, "db.user", "app") != "app" {
+		t.Errorf("Unexpected result of RedactValue")
+	}
+}
+
+func Test_sensitive_configuration(t *testing.T) {
+	f, err := ioutil.TempFile("", "flexconfigSensitive")
+	if err != nil {
+		t.Errorf("Can't create temporary file")
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	f.WriteString("from file")
+	f.Close()
+
+	os.Args = []string{}
+	os.Setenv("TEST_SENSITIVE_API_KEY_FILE", f.Name())
+	defer os.Unsetenv("TEST_SENSITIVE_API_KEY_FILE")
+
+	fsys := fstest.MapFS{
+		"etc/sensApp/app.conf": {Data: []byte(
+			"db:\n  user: app\n  password: pw\n" +
+				"  dsn: ${db.user}:${db.password}@host\n" +
+				"  fallback: ${db.missing:-${db.password}}\n" +
+				"  literal: $${db.password}\n" +
+				"cert:\n  key: ${file:" + f.Name() + "}\n")},
+	}
+
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName:             "sensApp",
+		FileSystem:                  fsys,
+		EnvironmentVariablePrefixes: []string{"TEST_SENSITIVE_"},
+		FileEnvironmentVariables:    true,
+		SensitiveKeys:               []string{"*.password"},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	sensitive := map[string]bool{
+		"db.user":                 false,
+		"db.password":             true,
+		"db.dsn":                  true,
+		"db.fallback":             true,
+		"db.literal":              false,
+		"cert.key":                true,
+		"test.sensitive.api.key":  true,
+		"test.sensitive.api.none": false,
+	}
+
+	for k, expected := range sensitive {
+		if c.(ExtendedConfig).IsSensitive(k) != expected {
+			t.Errorf("Unexpected sensitivity for %s", k)
+		}
+	}
+
+	fc := c.(*flexibleConfiguration)
+	if fc.redact("db.dsn", c.Get("db.dsn")) != RedactedValue {
+		t.Errorf("Sensitive value not redacted")
+	}
+
+	if fc.redact("db.user", c.Get("db.user")) != "app" {
+		t.Errorf("Value redacted unexpectedly")
+	}
+}
+
+func Test_sensitive_errorRedaction(t *testing.T) {
+	os.Args = []string{}
+	c, err := NewFlexibleConfiguration(ConfigurationParameters{
+		FileSystem:    fstest.MapFS{},
+		SensitiveKeys: []string{"*.token"},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	c.Set("api.token", "${base64:bm90LWJhc2U2NA=!}")
+	_, err = c.(ExtendedConfig).Lookup("api.token")
+	if err == nil {
+		t.Errorf("Unexpected success resolving bad data")
+		return
+	}
+
+	if strings.Contains(err.Error(), "bm90") {
+		t.Errorf("Error reveals sensitive reference: %v", err)
+	}
+}
+
+func Test_sensitive_forEachReference(t *testing.T) {
+	var exprs []string
+	forEachReference("a ${b} $${c} ${d:-${e}} ${unterminated", func(expr string) bool {
+		exprs = append(exprs, expr)
+		return true
+	})
+
+	if strings.Join(exprs, "|") != "b|d:-${e}" {
+		t.Errorf("Unexpected references: %v", exprs)
+	}
+}
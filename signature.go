@@ -0,0 +1,286 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// SignaturePolicy is an enumerated type defining what is done when a
+// configuration file has no signature, or a signature that cannot be verified
+// using the trusted keys.
+type SignaturePolicy int
+
+const (
+	// SignaturesIgnore is a value of SignaturePolicy indicating that
+	// signatures are not verified. This is the default.
+	SignaturesIgnore SignaturePolicy = iota
+
+	// SignaturesSkip is a value of SignaturePolicy indicating that a file
+	// without a valid signature is not read.
+	SignaturesSkip
+
+	// SignaturesWarn is a value of SignaturePolicy indicating that a
+	// warning is reported for a file without a valid signature, and the
+	// file is still read.
+	SignaturesWarn
+
+	// SignaturesFail is a value of SignaturePolicy indicating that a file
+	// without a valid signature is not read, and the configuration cannot
+	// be created.
+	SignaturesFail
+)
+
+const (
+	signatureSuffix          = ".sig"
+	minisignUntrustedComment = "untrusted comment:"
+	minisignTrustedComment   = "trusted comment: "
+	minisignAlgorithmEd25519 = "Ed"
+	minisignAlgorithmHashed  = "ED"
+	minisignKeyIDSize        = 8
+)
+
+var (
+	// ErrSignatureMissing indicates a configuration file has no
+	// signature file.
+	ErrSignatureMissing = errors.New("Configuration file signature missing")
+
+	// ErrSignatureNotValid indicates the signature of a configuration
+	// file is malformed or was not made by any of the trusted keys.
+	ErrSignatureNotValid = errors.New(
+		"Configuration file signature not valid")
+
+	// ErrTrustedKeysRequired indicates signatures are to be verified but
+	// no trusted keys were specified.
+	ErrTrustedKeysRequired = errors.New("Trusted keys required")
+
+	// ErrTrustedKeyNotValid indicates a public key could not be parsed.
+	ErrTrustedKeyNotValid = errors.New("Trusted key not valid")
+)
+
+// String returns the string representation of the SignaturePolicy.
+func (sp SignaturePolicy) String() string {
+	switch sp {
+	case SignaturesIgnore:
+		return "ignore"
+	case SignaturesSkip:
+		return "skip"
+	case SignaturesWarn:
+		return "warn"
+	case SignaturesFail:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// TrustedKey is an ed25519 public key trusted to sign configuration files.
+// ID is the key identifier of a minisign key, and is nil for a key that was
+// specified without one.
+type TrustedKey struct {
+	ID  []byte
+	Key ed25519.PublicKey
+}
+
+// ParseTrustedKey parses an ed25519 public key, which is either the base64
+// encoding of the 32 byte key, or the contents of a minisign public key file,
+// such as:
+//
+//	untrusted comment: minisign public key 1A2B3C4D5E6F7A8B
+//	RWSLen...
+func ParseTrustedKey(text string) (TrustedKey, error) {
+	encoded := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 &&
+			!strings.HasPrefix(line, minisignUntrustedComment) {
+			encoded = line
+			break
+		}
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return TrustedKey{}, ErrTrustedKeyNotValid
+	}
+
+	if len(decoded) == ed25519.PublicKeySize {
+		return TrustedKey{Key: ed25519.PublicKey(decoded)}, nil
+	}
+
+	algorithmSize := len(minisignAlgorithmEd25519)
+	if len(decoded) != algorithmSize+minisignKeyIDSize+ed25519.PublicKeySize ||
+		string(decoded[:algorithmSize]) != minisignAlgorithmEd25519 {
+		return TrustedKey{}, ErrTrustedKeyNotValid
+	}
+
+	return TrustedKey{
+		ID:  decoded[algorithmSize : algorithmSize+minisignKeyIDSize],
+		Key: ed25519.PublicKey(decoded[algorithmSize+minisignKeyIDSize:]),
+	}, nil
+}
+
+// verifySignature checks that the signature was made over the contents by
+// one of the trusted keys. The signature is either the base64 encoding of an
+// ed25519 signature, or a minisign signature using either the legacy "Ed"
+// algorithm or the prehashed "ED" algorithm used by default since minisign
+// 0.10, whose trusted comment is verified as well.
+func verifySignature(keys []TrustedKey, contents, signature []byte) error {
+	var lines []string
+	for _, line := range strings.Split(string(signature), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > 0 && strings.HasPrefix(lines[0], minisignUntrustedComment) {
+		return verifyMinisignSignature(keys, contents, lines)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(signature)))
+	if err != nil {
+		sig = signature
+	}
+
+	if len(sig) != ed25519.SignatureSize {
+		return ErrSignatureNotValid
+	}
+
+	for _, k := range keys {
+		if ed25519.Verify(k.Key, contents, sig) {
+			return nil
+		}
+	}
+
+	return ErrSignatureNotValid
+}
+
+// verifyMinisignSignature checks the lines of a minisign signature file: an
+// untrusted comment, the signature, a trusted comment, and the signature of
+// the trusted comment. A signature using the "ED" algorithm is made over the
+// BLAKE2b-512 hash of the contents rather than the contents themselves.
+func verifyMinisignSignature(
+	keys []TrustedKey,
+	contents []byte,
+	lines []string) error {
+	if len(lines) < 4 ||
+		!strings.HasPrefix(lines[2], minisignTrustedComment) {
+		return ErrSignatureNotValid
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(lines[1])
+	algorithmSize := len(minisignAlgorithmEd25519)
+	if err != nil ||
+		len(decoded) != algorithmSize+minisignKeyIDSize+ed25519.SignatureSize {
+		return ErrSignatureNotValid
+	}
+
+	switch string(decoded[:algorithmSize]) {
+	case minisignAlgorithmEd25519:
+	case minisignAlgorithmHashed:
+		hash := blake2b.Sum512(contents)
+		contents = hash[:]
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q",
+			ErrSignatureNotValid, decoded[:algorithmSize])
+	}
+
+	keyID := decoded[algorithmSize : algorithmSize+minisignKeyIDSize]
+	sig := decoded[algorithmSize+minisignKeyIDSize:]
+
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return ErrSignatureNotValid
+	}
+
+	trusted := []byte(strings.TrimPrefix(lines[2], minisignTrustedComment))
+	global := append(append([]byte{}, sig...), trusted...)
+
+	for _, k := range keys {
+		if k.ID != nil && !bytes.Equal(k.ID, keyID) {
+			continue
+		}
+
+		if ed25519.Verify(k.Key, contents, sig) &&
+			ed25519.Verify(k.Key, global, globalSig) {
+			return nil
+		}
+	}
+
+	return ErrSignatureNotValid
+}
+
+// signatureCheck holds the settings used to verify the signatures of
+// configuration files, and the first file rejected by the check. A single
+// signatureCheck is shared by every fileOptions used while reading a
+// configuration.
+type signatureCheck struct {
+	policy SignaturePolicy
+	keys   []TrustedKey
+	warn   func(warning string)
+	err    error
+}
+
+// enabled returns whether signatures of configuration files are checked.
+func (sc *signatureCheck) enabled() bool {
+	return sc != nil && sc.policy != SignaturesIgnore
+}
+
+// allow returns whether a configuration file may be read, given its contents
+// and a function returning the contents of its signature file. A file
+// without a valid signature is handled according to the policy.
+func (sc *signatureCheck) allow(
+	name string,
+	contents []byte,
+	readSignature func() ([]byte, error)) bool {
+	if !sc.enabled() {
+		return true
+	}
+
+	var problem error
+	signature, err := readSignature()
+	if err != nil {
+		problem = ErrSignatureMissing
+	} else {
+		problem = verifySignature(sc.keys, contents, signature)
+	}
+
+	if problem == nil {
+		return true
+	}
+
+	switch sc.policy {
+	case SignaturesWarn:
+		sc.warn(fmt.Sprintf("Configuration file %s: %v", name, problem))
+		return true
+	case SignaturesFail:
+		if sc.err == nil {
+			sc.err = fmt.Errorf("%w: %s", problem, name)
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,288 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// minisignSignature returns a minisign signature file for the contents.
+func minisignSignature(
+	priv ed25519.PrivateKey,
+	keyID []byte,
+	contents []byte,
+	comment string) []byte {
+	sig := ed25519.Sign(priv, contents)
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+
+	encoded := append(append([]byte("Ed"), keyID...), sig...)
+
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(encoded) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+// minisignPublicKey returns a minisign public key file for the key.
+func minisignPublicKey(pub ed25519.PublicKey, keyID []byte) string {
+	encoded := append(append([]byte("Ed"), keyID...), pub...)
+
+	return "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(encoded) + "\n"
+}
+
+func Test_signature_parseTrustedKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	keyID := []byte("12345678")
+
+	key, err := ParseTrustedKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil || key.ID != nil || !pub.Equal(key.Key) {
+		t.Errorf("Unexpected result parsing raw key: %v %v", key, err)
+	}
+
+	key, err = ParseTrustedKey(minisignPublicKey(pub, keyID))
+	if err != nil || string(key.ID) != "12345678" || !pub.Equal(key.Key) {
+		t.Errorf("Unexpected result parsing minisign key: %v %v", key, err)
+	}
+
+	for _, bad := range []string{"", "not base64!", "aGVsbG8="} {
+		_, err = ParseTrustedKey(bad)
+		if !errors.Is(err, ErrTrustedKeyNotValid) {
+			t.Errorf("Expected ErrTrustedKeyNotValid for '%s', found %v",
+				bad, err)
+		}
+	}
+}
+
+func Test_signature_verify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	otherPub, otherPriv, _ := ed25519.GenerateKey(nil)
+	keyID := []byte("12345678")
+	contents := []byte("a.b: c\n")
+
+	raw, _ := ParseTrustedKey(base64.StdEncoding.EncodeToString(pub))
+	mini, _ := ParseTrustedKey(minisignPublicKey(pub, keyID))
+	other, _ := ParseTrustedKey(base64.StdEncoding.EncodeToString(otherPub))
+
+	rawSig := []byte(base64.StdEncoding.EncodeToString(
+		ed25519.Sign(priv, contents)) + "\n")
+	miniSig := minisignSignature(priv, keyID, contents, "timestamp:1")
+
+	tests := []struct {
+		keys      []TrustedKey
+		contents  []byte
+		signature []byte
+		valid     bool
+	}{
+		{[]TrustedKey{raw}, contents, rawSig, true},
+		{[]TrustedKey{other, raw}, contents, rawSig, true},
+		{[]TrustedKey{other}, contents, rawSig, false},
+		{[]TrustedKey{raw}, []byte("a.b: d\n"), rawSig, false},
+		{[]TrustedKey{raw}, contents, ed25519.Sign(priv, contents), true},
+		{[]TrustedKey{mini}, contents, miniSig, true},
+		{[]TrustedKey{raw}, contents, miniSig, true},
+		{[]TrustedKey{other}, contents, miniSig, false},
+		{[]TrustedKey{mini}, contents,
+			minisignSignature(priv, []byte("87654321"), contents, "x"),
+			false},
+		{[]TrustedKey{other}, contents,
+			minisignSignature(otherPriv, keyID, contents, "x"), true},
+		{[]TrustedKey{raw}, contents, []byte("garbage"), false},
+	}
+
+	for i, test := range tests {
+		err := verifySignature(test.keys, test.contents, test.signature)
+		if test.valid && err != nil {
+			t.Errorf("Test %d: unexpected error: %v", i, err)
+		}
+
+		if !test.valid && !errors.Is(err, ErrSignatureNotValid) {
+			t.Errorf("Test %d: expected ErrSignatureNotValid, found %v",
+				i, err)
+		}
+	}
+
+	// A tampered trusted comment is detected
+	tampered := strings.Replace(string(miniSig), "timestamp:1",
+		"timestamp:2", 1)
+	err := verifySignature([]TrustedKey{mini}, contents, []byte(tampered))
+	if !errors.Is(err, ErrSignatureNotValid) {
+		t.Errorf("Expected tampered comment to be rejected, found %v", err)
+	}
+}
+
+func Test_signature_policies(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	key, _ := ParseTrustedKey(base64.StdEncoding.EncodeToString(pub))
+
+	signed := []byte("signed.value: ok\n")
+	badlySigned := []byte("bad.value: ok\n")
+	fsys := fstest.MapFS{
+		"etc/app/a.conf":     {Data: signed},
+		"etc/app/a.conf.sig": {Data: ed25519.Sign(priv, signed)},
+		"etc/app/b.conf":     {Data: badlySigned},
+		"etc/app/b.conf.sig": {Data: ed25519.Sign(priv, signed)},
+		"etc/app/c.conf":     {Data: []byte("unsigned.value: ok\n")},
+	}
+
+	var warnings []string
+	warn := func(warning string) { warnings = append(warnings, warning) }
+
+	expected := map[SignaturePolicy]int{
+		SignaturesIgnore: 3,
+		SignaturesSkip:   1,
+		SignaturesWarn:   3,
+		SignaturesFail:   1,
+	}
+
+	for policy, count := range expected {
+		warnings = nil
+		sc := &signatureCheck{
+			policy: policy,
+			keys:   []TrustedKey{key},
+			warn:   warn,
+		}
+
+		vars := make(map[string]string)
+		readFiles(vars, "/etc/app", []string{".conf"},
+			&fileOptions{fsys: fsys, signatures: sc})
+
+		if len(vars) != count || vars["signed.value"] != "ok" {
+			t.Errorf("%v: expected %d properties, found %v",
+				policy, count, vars)
+		}
+
+		if policy == SignaturesWarn && len(warnings) != 2 {
+			t.Errorf("Expected 2 warnings, found %v", warnings)
+		}
+
+		if policy == SignaturesFail &&
+			(!errors.Is(sc.err, ErrSignatureNotValid) ||
+				!strings.Contains(sc.err.Error(), "b.conf")) {
+			t.Errorf("Expected error naming b.conf, found %v", sc.err)
+		}
+	}
+
+	if SignaturesFail.String() != "fail" ||
+		SignaturePolicy(9).String() != "unknown" {
+		t.Errorf("Unexpected SignaturePolicy strings")
+	}
+}
+
+func Test_signature_configuration(t *testing.T) {
+	os.Args = []string{}
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	key, _ := ParseTrustedKey(base64.StdEncoding.EncodeToString(pub))
+
+	contents := []byte("app.value: trusted\n")
+	fsys := fstest.MapFS{
+		"etc/sigApp/app.conf":     {Data: contents},
+		"etc/sigApp/app.conf.sig": {Data: ed25519.Sign(priv, contents)},
+		"etc/sigApp/bad.conf":     {Data: []byte("app.other: x\n")},
+	}
+
+	_, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "sigApp",
+		FileSystem:      fsys,
+		SignaturePolicy: SignaturesFail,
+	})
+	if !errors.Is(err, ErrTrustedKeysRequired) {
+		t.Errorf("Expected ErrTrustedKeysRequired, found %v", err)
+	}
+
+	_, err = NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "sigApp",
+		FileSystem:      fsys,
+		SignaturePolicy: SignaturesFail,
+		TrustedKeys:     []TrustedKey{key},
+	})
+	if !errors.Is(err, ErrSignatureMissing) {
+		t.Errorf("Expected ErrSignatureMissing, found %v", err)
+	}
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ApplicationName: "sigApp",
+		FileSystem:      fsys,
+		DefaultConfiguration: fstest.MapFS{
+			"defaults.conf": {Data: []byte("app.default: unsigned\n")},
+		},
+		SignaturePolicy: SignaturesSkip,
+		TrustedKeys:     []TrustedKey{key},
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if cfg.Get("app.value") != "trusted" || cfg.Exists("app.other") ||
+		cfg.Get("app.default") != "unsigned" {
+		t.Errorf("Unexpected configuration: value '%s', other '%s', "+
+			"default '%s'", cfg.Get("app.value"), cfg.Get("app.other"),
+			cfg.Get("app.default"))
+	}
+}
+
+// Signatures of the contents "test" made by minisign itself, in the legacy
+// and the prehashed formats, and the public key that verifies them.
+const (
+	minisignTestKey = "untrusted comment: minisign public key E7620F1842B4E81F\n" +
+		"RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3\n"
+	minisignTestLegacySig = "untrusted comment: signature from minisign secret key\n" +
+		"RWQf6LRCGA9i59SLOFxz6NxvASXDJeRtuZykwQepbDEGt87ig1BNpWaVWuNrm73YiIiJbq71Wi+dP9eKL8OC351vwIasSSbXxwA=\n" +
+		"trusted comment: timestamp:1635442742\tfile:test\n" +
+		"0YteLgV960ia80vnA/fHbvkyjl/IoP/HNOCaZfrF0CdhAlp7ok+Tpkya+VpWPX5C/Is3q8a/kEDSY7fBmmgJCg==\n"
+	minisignTestHashedSig = "untrusted comment: signature from minisign secret key\n" +
+		"RUQf6LRCGA9i559r3g7V1qNyJDApGip8MfqcadIgT9CuhV3EMhHoN1mGTkUidF/z7SrlQgXdy8ofjb7bNJJylDOocrCo8KLzZwo=\n" +
+		"trusted comment: timestamp:1635443258\tfile:test\thashed\n" +
+		"/cj37GK60vryibFn+ftOgbCvW9NKhKYgjVpFFQUcWPAnjO23wrvVDTt7cloNC06maoBli9q6qwZDXXoaxweICQ==\n"
+)
+
+func Test_signature_minisignTool(t *testing.T) {
+	key, err := ParseTrustedKey(minisignTestKey)
+	if err != nil {
+		t.Errorf("Unexpected error parsing key: %v", err)
+		return
+	}
+
+	keys := []TrustedKey{key}
+	for _, sig := range []string{minisignTestLegacySig, minisignTestHashedSig} {
+		err = verifySignature(keys, []byte("test"), []byte(sig))
+		if err != nil {
+			t.Errorf("Unexpected error verifying %q: %v", sig, err)
+		}
+
+		err = verifySignature(keys, []byte("tesT"), []byte(sig))
+		if !errors.Is(err, ErrSignatureNotValid) {
+			t.Errorf("Expected ErrSignatureNotValid for changed contents, "+
+				"found %v", err)
+		}
+
+		tampered := strings.Replace(sig, "file:test", "file:tesT", 1)
+		err = verifySignature(keys, []byte("test"), []byte(tampered))
+		if !errors.Is(err, ErrSignatureNotValid) {
+			t.Errorf("Expected ErrSignatureNotValid for changed comment, "+
+				"found %v", err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrSnapshotNotValid indicates the Config passed to Restore is not a
+	// snapshot of the configuration being restored.
+	ErrSnapshotNotValid = errors.New("Snapshot not valid")
+)
+
+// Snapshot returns an immutable view of the configuration: the memory store
+// and the values in the configuration store as they were when Snapshot was
+// called. All reads from the snapshot see that one version, however the
+// configuration changes afterwards, so a request can use a snapshot to avoid
+// observing a partly applied set of updates to the configuration store. The
+// values in the configuration store are read in a single request. Set and
+// Load return ErrConfigurationFrozen for a snapshot. References to resolvers
+// are resolved when the snapshot is read.
+func (fc *flexibleConfiguration) Snapshot() (Config, error) {
+	snap := new(flexibleConfiguration)
+	snap.appName = fc.appName
+	snap.iniPrefix = fc.iniPrefix
+	snap.envPrefixes = fc.envPrefixes
+	snap.decrypters = fc.decrypters
+	snap.sensitivePatterns = fc.sensitivePatterns
+	snap.resolved = fc.resolved
+	snap.interpolate = fc.interpolate
+	snap.resolveStore = fc.resolveStore
+	snap.warn = fc.warn
+	snap.locked = append([]string(nil), fc.locked...)
+	snap.frozen = true
+	snap.aliases = fc.aliases
+	snap.knownKeys = fc.knownKeys
+	snap.strictKeys = fc.strictKeys
+	snap.keyDocs = fc.keyDocs
+	snap.snapshotOf = fc
+	snap.copyProperties(fc)
+
+	if fc.store != nil {
+		kvs, err := fc.store.GetAll()
+		if err != nil {
+			return nil, err
+		}
+
+		store := &snapshotStore{prefix: fc.store.GetPrefix(),
+			kvs: make(map[string]string)}
+		for _, kv := range kvs {
+			store.kvs[kv.Key] = kv.Value
+		}
+
+		snap.store = store
+	}
+
+	return snap, nil
+}
+
+// Restore returns the memory store to its contents when the snapshot was
+// taken, undoing changes made by Set and Load since then. Values written to
+// the configuration store are not changed. No properties are changed if any
+// property that would change is locked, or if the configuration is frozen.
+// ErrSnapshotNotValid is returned if the snapshot was not taken from this
+// configuration.
+func (fc *flexibleConfiguration) Restore(snapshot Config) error {
+	snap, ok := snapshot.(*flexibleConfiguration)
+	if !ok || snap.snapshotOf != fc {
+		return ErrSnapshotNotValid
+	}
+
+	changed := make(map[string]string)
+	for k, v := range fc.config {
+		if snap.config[k] != v {
+			changed[strings.TrimSpace(k)] = snap.config[k]
+		}
+	}
+
+	for k, v := range snap.config {
+		if _, exists := fc.config[k]; !exists {
+			changed[strings.TrimSpace(k)] = v
+		}
+	}
+
+	err := fc.checkAllWritable(changed)
+	if err != nil {
+		fc.audit(auditOperationRestore, "", "", "", sourceRestore, err)
+		return err
+	}
+
+	old := fc.config
+	fc.copyProperties(snap)
+
+	for _, k := range sortedKeys(changed) {
+		fc.audit(auditOperationRestore, k, old[k], changed[k], sourceRestore,
+			nil)
+	}
+
+	return nil
+}
+
+// copyProperties replaces the memory store, and the sensitivity and sources
+// of its properties, with copies of those of another configuration.
+func (fc *flexibleConfiguration) copyProperties(from *flexibleConfiguration) {
+	fc.config = make(map[string]string, len(from.config))
+	for k, v := range from.config {
+		fc.config[k] = v
+	}
+
+	fc.sensitive = make(map[string]bool, len(from.sensitive))
+	for k, v := range from.sensitive {
+		fc.sensitive[k] = v
+	}
+
+	fc.sources = make(map[string][]Provenance, len(from.sources))
+	for k, v := range from.sources {
+		fc.sources[k] = append([]Provenance(nil), v...)
+	}
+}
+
+// snapshotStore is a read-only FlexConfigStore holding the values of another
+// store at one instant.
+type snapshotStore struct {
+	prefix string
+	kvs    map[string]string
+}
+
+// Get returns the value of the property when the snapshot was taken.
+func (ss *snapshotStore) Get(key string) (string, error) {
+	if len(key) == 0 {
+		return "", ErrStoreKeyRequired
+	}
+
+	return ss.kvs[strings.TrimSpace(key)], nil
+}
+
+// GetAll returns all properties in the store when the snapshot was taken.
+func (ss *snapshotStore) GetAll() ([]KeyValue, error) {
+	var result []KeyValue
+	for _, k := range sortedKeys(ss.kvs) {
+		result = append(result, KeyValue{Key: k, Value: ss.kvs[k]})
+	}
+
+	return result, nil
+}
+
+// Set returns ErrConfigurationFrozen, since a snapshot cannot be changed.
+func (ss *snapshotStore) Set(key, val string) error {
+	return ErrConfigurationFrozen
+}
+
+// Delete returns ErrConfigurationFrozen, since a snapshot cannot be changed.
+func (ss *snapshotStore) Delete(key string) error {
+	return ErrConfigurationFrozen
+}
+
+// GetPrefix returns the prefix of the store the snapshot was taken from.
+func (ss *snapshotStore) GetPrefix() string {
+	return ss.prefix
+}
@@ -0,0 +1,136 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_snapshot_consistentView(t *testing.T) {
+	os.Args = []string{}
+
+	store := newMemStore("/app")
+	store.Set("db.host", "primary")
+	store.Set("db.port", "5432")
+
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		ConfigurationStore: store,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("app.level", "info")
+
+	snap, err := cfg.(ExtendedConfig).Snapshot()
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// A half-applied update to the store is not visible in the snapshot
+	store.Set("db.host", "replica")
+	cfg.Set("app.level", "debug")
+
+	if snap.Get("db.host") != "primary" || snap.Get("db.port") != "5432" ||
+		snap.Get("app.level") != "info" {
+		t.Errorf("Expected snapshot values, found %s %s %s",
+			snap.Get("db.host"), snap.Get("db.port"), snap.Get("app.level"))
+	}
+
+	if cfg.Get("db.host") != "replica" || cfg.Get("app.level") != "debug" {
+		t.Errorf("Expected live values to change")
+	}
+
+	if snap.Set("app.level", "x") != ErrConfigurationFrozen ||
+		snap.(ExtendedConfig).Load(strings.NewReader("a: b\n"),
+			ConfigurationFormatYAML) != ErrConfigurationFrozen {
+		t.Errorf("Expected snapshot to be immutable")
+	}
+
+	changes, err := Diff(snap, cfg)
+	if err != nil || len(changes) != 2 || changes[0].Key != "app.level" ||
+		changes[1].Key != "db.host" ||
+		changes[1].NewSource.Layer != sourceStore {
+		t.Errorf("Unexpected changes since snapshot: %v (%v)", changes, err)
+	}
+
+	err = cfg.(ExtendedConfig).Restore(snap)
+	if err != nil || store.kvs["db.host"] != "replica" ||
+		cfg.Get("db.host") != "replica" {
+		t.Errorf("Expected Restore not to change the store, found %v", err)
+	}
+}
+
+func Test_snapshot_restore(t *testing.T) {
+	os.Args = []string{}
+
+	sink := new(memAuditSink)
+	cfg, err := NewFlexibleConfiguration(ConfigurationParameters{
+		AuditSink: sink,
+	})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	cfg.Set("a.b", "1")
+	snap, _ := cfg.(ExtendedConfig).Snapshot()
+
+	cfg.Set("a.b", "2")
+	cfg.Set("c.d", "3")
+
+	err = cfg.(ExtendedConfig).Restore(snap)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if cfg.Get("a.b") != "1" || cfg.Exists("c.d") {
+		t.Errorf("Expected memory store to be restored, found %s %s",
+			cfg.Get("a.b"), cfg.Get("c.d"))
+	}
+
+	last := sink.events[len(sink.events)-1]
+	if last.Operation != "restore" || last.Key != "c.d" ||
+		last.OldValue != "3" || last.Layer != sourceRestore {
+		t.Errorf("Unexpected audit event: %+v", last)
+	}
+
+	// Restoring again after a further change still works
+	cfg.Set("a.b", "4")
+	if cfg.(ExtendedConfig).Restore(snap) != nil || cfg.Get("a.b") != "1" {
+		t.Errorf("Expected second restore to succeed")
+	}
+
+	cfg.Set("a.b", "5")
+	cfg.(ExtendedConfig).Lock("a.b")
+	if !errors.Is(cfg.(ExtendedConfig).Restore(snap), ErrPropertyLocked) ||
+		cfg.Get("a.b") != "5" {
+		t.Errorf("Expected Restore of a locked property to fail")
+	}
+
+	other, _ := NewFlexibleConfiguration(ConfigurationParameters{})
+	if other.(ExtendedConfig).Restore(snap) != ErrSnapshotNotValid ||
+		other.(ExtendedConfig).Restore(other) != ErrSnapshotNotValid {
+		t.Errorf("Expected ErrSnapshotNotValid")
+	}
+}
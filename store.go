@@ -17,6 +17,7 @@ limitations under the License.
 */
 
 import (
+	"context"
 	"errors"
 )
 
@@ -42,6 +43,10 @@ var (
 	// ErrStoreKeyRequired indicates that the requested function requires a
 	// property key as a parameter.
 	ErrStoreKeyRequired = errors.New("Key is required")
+
+	// ErrStoreWatchEnded indicates that the store stopped reporting
+	// changes to its properties before the context of the watch was done.
+	ErrStoreWatchEnded = errors.New("Watch of the store ended")
 )
 
 // FlexConfigStore describes the interface to a flexible configuration store.
@@ -60,7 +65,7 @@ type FlexConfigStore interface {
 	// specified value.
 	Set(key, val string) error
 
-	// Delete removes the specified property.
+	// Delete removes the specified property and the properties below it.
 	Delete(key string) error
 
 	// GetPrefix returns the "namespace" prefix specified when the
@@ -74,6 +79,39 @@ type KeyValue struct {
 	Value string
 }
 
+// FlexConfigStoreWatcher is implemented by a FlexConfigStore able to report
+// changes to its properties as they are made, such as the etcd store.
+type FlexConfigStoreWatcher interface {
+	// Watch sends an event on the returned channel for every change to
+	// the property with the specified key, or to a property below it,
+	// until the context is done or the watch fails, when the channel is
+	// closed. A failed watch sends a last event whose Err is set. If the
+	// key is empty, changes to every property in the store are sent.
+	Watch(ctx context.Context, key string) (<-chan WatchEvent, error)
+}
+
+// FlexConfigStoreBatcher is implemented by a FlexConfigStore able to change
+// several properties in a single atomic operation, such as the etcd store.
+type FlexConfigStoreBatcher interface {
+	// ApplyBatch sets each property in desired to its value, deleting
+	// the property if the value is empty, provided each property in
+	// expected still has the value given, where an empty value means
+	// the property is not set. Otherwise no property is changed and
+	// ErrStoreChanged is returned.
+	ApplyBatch(expected, desired map[string]string) error
+}
+
+// WatchEvent describes a change to a property in a FlexConfigStore. Value is
+// the new value of the property, and is empty if it was deleted. Err is only
+// set on the last event sent by a watch that failed, which describes no
+// change.
+type WatchEvent struct {
+	Key     string
+	Value   string
+	Deleted bool
+	Err     error
+}
+
 // NewFlexConfigStore creates a FlexConfigStore instance for the specified
 // store type. Supported store types include: etcd. The store type may
 // require passing zero or more endpoints for the store in order to instantiate
@@ -90,6 +128,32 @@ func NewFlexConfigStore(
 	}
 }
 
+// StoreCredentials holds the user name and password used to authenticate to
+// a configuration store.
+type StoreCredentials struct {
+	Username string
+	Password string
+}
+
+// NewAuthenticatedFlexConfigStore creates a FlexConfigStore in the same way
+// as NewFlexConfigStore, authenticating to the store using the specified
+// credentials. For etcd, the roles granted to the user restrict the keys the
+// store can read and write, and a write denied by etcd returns a
+// *WriteDeniedError identifying the user.
+func NewAuthenticatedFlexConfigStore(
+	storeType FlexConfigStoreType,
+	endpoints []string,
+	prefix string,
+	credentials StoreCredentials) (FlexConfigStore, error) {
+	switch storeType {
+	case FlexConfigStoreEtcd:
+		return newAuthenticatedEtcdFlexConfigStore(endpoints, prefix,
+			credentials)
+	default:
+		return nil, ErrStoreUnsupportedType
+	}
+}
+
 // String returns the string representation of the FlexConfigStoreType.
 func (fcst FlexConfigStoreType) String() string {
 	switch fcst {
@@ -0,0 +1,272 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// StoreFileOptions controls how ImportStoreFile and ExportStoreFile copy
+// properties between a FlexConfigStore and a configuration file.
+//
+// Format is the format of the file, and is implied by the suffix of the file
+// name if it is ConfigurationFormatUnknown. Only YAML, JSON, and INI files
+// can be imported and exported.
+//
+// DryRun, if true, returns the changes that would be made without changing
+// the store or the file.
+//
+// SensitiveKeys lists keys, or patterns as described for SensitiveKeys in
+// ConfigurationParameters, whose values are replaced by RedactedValue in
+// the changes returned.
+type StoreFileOptions struct {
+	Format        ConfigurationFormat
+	DryRun        bool
+	SensitiveKeys []string
+}
+
+// ImportStoreFile reads the properties in a YAML, JSON, or INI configuration
+// file and writes each property whose value differs into the store, such as
+// to seed the configuration store for a new environment from a file that is
+// kept under version control. INI files are read with an empty
+// IniNamePrefix. Properties in the store that are not in the file, and
+// properties with empty values in the file, are not changed, as a store does
+// not hold empty values. The changes are returned in order of key, with the
+// old values from the store and the new values from the file. The changes
+// are made as by StorePlan.Apply: in a single atomic operation if the store
+// implements FlexConfigStoreBatcher, and otherwise one at a time, in which
+// case those made before a failure remain. No changes are returned with an
+// error.
+func ImportStoreFile(
+	store FlexConfigStore,
+	path string,
+	opts StoreFileOptions) ([]Change, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := storeFileFormat(path, opts.Format, true)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	err = parseConfigContents(vars, format, string(contents), "")
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range vars {
+		if len(v) == 0 {
+			delete(vars, k)
+		}
+	}
+
+	current, err := storeProperties(store)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := compareProperties(current, vars, false,
+		storeSource(store), fileSource(path, string(contents)))
+
+	if !opts.DryRun && len(changes) > 0 {
+		expected := make(map[string]string)
+		desired := make(map[string]string)
+		for _, c := range changes {
+			expected[c.Key] = current[c.Key]
+			desired[c.Key] = vars[c.Key]
+		}
+
+		err = applyBatch(store, expected, desired)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return redactChanges(changes, opts.SensitiveKeys), nil
+}
+
+// ExportStoreFile writes every property in the store to a YAML, JSON, or
+// INI configuration file, replacing its contents. Keys are nested in the
+// same way as by Export, and ErrExportKeyNotInSection is returned, without
+// changing the file, for an INI file if the store holds a property whose key
+// has a single component. The changes to the file are returned in order of
+// key, with the old values from the file, if it exists, and the new values
+// from the store. The file is created with permissions allowing only its
+// owner to read it.
+func ExportStoreFile(
+	store FlexConfigStore,
+	path string,
+	opts StoreFileOptions) ([]Change, error) {
+	format, err := storeFileFormat(path, opts.Format, false)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := storeProperties(store)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = writeProperties(&buf, format, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	existing := make(map[string]string)
+	if len(contents) > 0 {
+		err = parseConfigContents(existing, format, string(contents), "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changes := compareProperties(existing, vars, true,
+		fileSource(path, string(contents)), storeSource(store))
+
+	if !opts.DryRun {
+		err = ioutil.WriteFile(path, buf.Bytes(), 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return redactChanges(changes, opts.SensitiveKeys), nil
+}
+
+// storeFileFormat returns the format of a file being imported or exported.
+// A file whose format is not specified or implied by its name can only be
+// imported, when its format is detected from its contents.
+func storeFileFormat(
+	path string,
+	format ConfigurationFormat,
+	detect bool) (ConfigurationFormat, error) {
+	if format == ConfigurationFormatUnknown {
+		format = configFormatFromName(path)
+	}
+
+	switch format {
+	case ConfigurationFormatYAML, ConfigurationFormatJSON,
+		ConfigurationFormatINI:
+		return format, nil
+	case ConfigurationFormatUnknown:
+		if detect {
+			return format, nil
+		}
+	}
+
+	return ConfigurationFormatUnknown, ErrFormatNotRecognized
+}
+
+// storeProperties returns every property in the store that has a value.
+func storeProperties(store FlexConfigStore) (map[string]string, error) {
+	kvs, err := store.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, kv := range kvs {
+		if len(kv.Key) > 0 && len(kv.Value) > 0 {
+			vars[kv.Key] = kv.Value
+		}
+	}
+
+	return vars, nil
+}
+
+// compareProperties returns the changes needed to make the properties in
+// from match those in to, in order of key. Properties that are only in from
+// are removed if remove is true, and otherwise left unchanged. The source
+// functions describe where the value of a property in each was defined.
+func compareProperties(
+	from, to map[string]string,
+	remove bool,
+	fromSource, toSource func(k string) Provenance) []Change {
+	var changes []Change
+	for k, newValue := range to {
+		oldValue, exists := from[k]
+		if exists && oldValue == newValue {
+			continue
+		}
+
+		c := Change{Type: ChangeAdded, Key: k, NewValue: newValue,
+			NewSource: toSource(k)}
+		if exists {
+			c.Type = ChangeModified
+			c.OldValue = oldValue
+			c.OldSource = fromSource(k)
+		}
+
+		changes = append(changes, c)
+	}
+
+	if remove {
+		for k, oldValue := range from {
+			if _, exists := to[k]; !exists {
+				changes = append(changes, Change{Type: ChangeRemoved,
+					Key: k, OldValue: oldValue, OldSource: fromSource(k)})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// redactChanges replaces the values in the changes of properties matching
+// the sensitive keys by RedactedValue.
+func redactChanges(changes []Change, sensitiveKeys []string) []Change {
+	for i, c := range changes {
+		if matchesKeyPattern(sensitiveKeys, c.Key) {
+			changes[i].OldValue = diffValue(c.OldValue, true)
+			changes[i].NewValue = diffValue(c.NewValue, true)
+		}
+	}
+
+	return changes
+}
+
+// storeSource returns a function describing a property in the store.
+func storeSource(store FlexConfigStore) func(k string) Provenance {
+	return func(k string) Provenance {
+		return Provenance{Layer: sourceStore, Path: store.GetPrefix()}
+	}
+}
+
+// fileSource returns a function describing a property in a configuration
+// file, including the line on which it appears to be defined.
+func fileSource(path, contents string) func(k string) Provenance {
+	return func(k string) Provenance {
+		return Provenance{Layer: sourceFile, Path: path,
+			Line: propertyLine(contents, k)}
+	}
+}
@@ -0,0 +1,170 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_storeFile_import(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigStoreFile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := dir + "/seed.yaml"
+	ioutil.WriteFile(filename, []byte("log:\n  level: info\n"+
+		"  filepath: /var/log/app.log\ndb:\n  password: secret\n"+
+		"  user: \"\"\n"), 0600)
+
+	store := newMemStore("/example")
+	store.Set("log.level", "debug")
+	store.Set("other", "kept")
+
+	opts := StoreFileOptions{DryRun: true, SensitiveKeys: []string{"*.password"}}
+	changes, err := ImportStoreFile(store, filename, opts)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if len(changes) != 3 || store.kvs["log.level"] != "debug" ||
+		len(store.kvs) != 2 {
+		t.Errorf("Expected dry run not to change the store: %v %v",
+			changes, store.kvs)
+	}
+
+	var buf bytes.Buffer
+	WriteDiff(&buf, changes)
+	expected := "+ db.password = ******** (" + filename + ":5)\n" +
+		"+ log.filepath = /var/log/app.log (" + filename + ":3)\n" +
+		"~ log.level = debug (configuration store) -> info (" +
+		filename + ":2)\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected changes:\n%s", buf.String())
+	}
+
+	opts.DryRun = false
+	changes, err = ImportStoreFile(store, filename, opts)
+	if err != nil || len(changes) != 3 || store.kvs["log.level"] != "info" ||
+		store.kvs["db.password"] != "secret" || store.kvs["other"] != "kept" {
+		t.Errorf("Unexpected import: %v %v (%v)", changes, store.kvs, err)
+	}
+
+	changes, err = ImportStoreFile(store, filename, opts)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes importing again: %v (%v)", changes, err)
+	}
+
+	batcher := &batchStore{memStore: newMemStore("/example")}
+	changes, err = ImportStoreFile(batcher, filename, opts)
+	if err != nil || len(changes) != 3 || batcher.batches != 1 ||
+		len(batcher.kvs) != 3 {
+		t.Errorf("Expected import in a single batch: %v %d (%v)",
+			batcher.kvs, batcher.batches, err)
+	}
+
+	_, err = ImportStoreFile(store, dir+"/missing.yaml", opts)
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected error for a missing file, found %v", err)
+	}
+}
+
+func Test_storeFile_export(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flexconfigStoreFile")
+	if err != nil {
+		t.Errorf("Can't create temporary directory")
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	store := newMemStore("/example")
+	store.Set("log.level", "info")
+	store.Set("servers.0", "alpha")
+	store.Set("servers.1", "beta")
+
+	filename := dir + "/dump.json"
+	ioutil.WriteFile(filename, []byte("{\"log\": {\"level\": \"debug\"}, "+
+		"\"removed\": \"yes\"}"), 0600)
+
+	changes, err := ExportStoreFile(store, filename,
+		StoreFileOptions{DryRun: true})
+	if err != nil || len(changes) != 4 ||
+		changes[0].Type != ChangeModified || changes[0].Key != "log.level" ||
+		changes[1].Type != ChangeRemoved || changes[1].Key != "removed" {
+		t.Errorf("Unexpected changes: %v (%v)", changes, err)
+	}
+
+	contents, _ := ioutil.ReadFile(filename)
+	if !strings.Contains(string(contents), "debug") {
+		t.Errorf("Expected dry run not to change the file: %s", contents)
+	}
+
+	_, err = ExportStoreFile(store, filename, StoreFileOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// Importing the exported file into an empty store reproduces the store
+	copied := newMemStore("/copy")
+	changes, err = ImportStoreFile(copied, filename, StoreFileOptions{})
+	if err != nil || len(changes) != 3 || len(copied.kvs) != 3 ||
+		copied.kvs["servers.1"] != "beta" {
+		t.Errorf("Unexpected round trip: %v (%v)", copied.kvs, err)
+	}
+
+	inifile := dir + "/dump.ini"
+	_, err = ExportStoreFile(store, inifile, StoreFileOptions{})
+	contents, _ = ioutil.ReadFile(inifile)
+	if err != nil || !strings.Contains(string(contents), "[log]\nlevel = info") {
+		t.Errorf("Unexpected INI export: %s (%v)", contents, err)
+	}
+
+	copied = newMemStore("/copy")
+	changes, err = ImportStoreFile(copied, inifile, StoreFileOptions{})
+	if err != nil || len(changes) != 3 || len(copied.kvs) != 3 ||
+		copied.kvs["servers.1"] != "beta" || copied.kvs["log.level"] != "info" {
+		t.Errorf("Unexpected INI round trip: %v (%v)", copied.kvs, err)
+	}
+
+	// A key with a single component has no section to be written in
+	store.Set("name", "app")
+	_, err = ExportStoreFile(store, inifile, StoreFileOptions{})
+	if !errors.Is(err, ErrExportKeyNotInSection) {
+		t.Errorf("Expected ErrExportKeyNotInSection, found %v", err)
+	}
+
+	if unchanged, _ := ioutil.ReadFile(inifile); string(unchanged) !=
+		string(contents) {
+		t.Errorf("Expected the file not to change: %s", unchanged)
+	}
+
+	_, err = ExportStoreFile(store, dir+"/dump.conf", StoreFileOptions{})
+	if err != ErrFormatNotRecognized {
+		t.Errorf("Expected ErrFormatNotRecognized, found %v", err)
+	}
+}
@@ -92,3 +92,58 @@ func Test_typeString(t *testing.T) {
 		t.Errorf("Unexpected string for known type: %s", str)
 	}
 }
+
+// memStore is a FlexConfigStore keeping properties in memory, allowing tests
+// of store interactions without a running etcd.
+type memStore struct {
+	prefix string
+	kvs    map[string]string
+}
+
+func newMemStore(prefix string) *memStore {
+	return &memStore{prefix: prefix, kvs: make(map[string]string)}
+}
+
+func (ms *memStore) Get(key string) (string, error) {
+	if len(key) == 0 {
+		return "", ErrStoreKeyRequired
+	}
+
+	return ms.kvs[key], nil
+}
+
+func (ms *memStore) GetAll() ([]KeyValue, error) {
+	var result []KeyValue
+	for k, v := range ms.kvs {
+		result = append(result, KeyValue{Key: k, Value: v})
+	}
+
+	return result, nil
+}
+
+func (ms *memStore) Set(key, val string) error {
+	if len(key) == 0 {
+		return ErrStoreKeyRequired
+	}
+
+	ms.kvs[key] = val
+	return nil
+}
+
+func (ms *memStore) Delete(key string) error {
+	if len(key) == 0 {
+		return ErrStoreKeyRequired
+	}
+
+	for k := range ms.kvs {
+		if k == key || strings.HasPrefix(k, key+".") {
+			delete(ms.kvs, k)
+		}
+	}
+
+	return nil
+}
+
+func (ms *memStore) GetPrefix() string {
+	return ms.prefix
+}
@@ -0,0 +1,369 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	vaultRequestTimeoutMs = 5000
+	vaultAddressEnvVar    = "VAULT_ADDR"
+	vaultTokenEnvVar      = "VAULT_TOKEN"
+	vaultNamespaceEnvVar  = "VAULT_NAMESPACE"
+	vaultTokenHeader      = "X-Vault-Token"
+	vaultNamespaceHeader  = "X-Vault-Namespace"
+	vaultFieldSeparator   = "#"
+)
+
+var (
+	// ErrVaultAddressRequired indicates no Vault address was specified in
+	// the VaultConfig or the environment variable VAULT_ADDR.
+	ErrVaultAddressRequired = errors.New("Vault address required")
+
+	// ErrVaultFieldRequired indicates a Vault reference does not name the
+	// field of the secret to use, as in secret/data/db#password.
+	ErrVaultFieldRequired = errors.New("Vault secret field required")
+
+	// ErrVaultSecretNotFound indicates Vault has no secret at the path,
+	// or the secret has no value for the field.
+	ErrVaultSecretNotFound = errors.New("Vault secret not found")
+)
+
+// VaultConfig specifies how a Vault resolver connects to a server providing
+// the Vault HTTP API.
+//
+// Address is the URL of the server, for example https://vault:8200. Token is
+// the Vault token used to authenticate requests. Namespace is the Vault
+// Enterprise namespace, if any. When empty, these fields are taken from the
+// environment variables VAULT_ADDR, VAULT_TOKEN, and VAULT_NAMESPACE.
+//
+// HTTPClient is the client used to make requests. If nil, a client with a
+// timeout of 5 seconds is used.
+type VaultConfig struct {
+	Address    string
+	Token      string
+	Namespace  string
+	HTTPClient *http.Client
+}
+
+// vaultSecret is a secret read from Vault and the lease under which it was
+// issued. Secrets without a lease, such as those in a KV store, do not
+// expire.
+type vaultSecret struct {
+	values    map[string]string
+	leaseID   string
+	renewable bool
+	renewAt   time.Time
+	expires   time.Time
+}
+
+// vaultResolver is a Resolver for secrets read from Vault.
+type vaultResolver struct {
+	config  VaultConfig
+	client  *http.Client
+	now     func() time.Time
+	lock    sync.Mutex
+	secrets map[string]*vaultSecret
+}
+
+// vaultResponse is the part of a Vault API response used by the resolver.
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// NewVaultResolver returns a Resolver reading secrets from Vault, to be
+// registered using RegisterResolver. A reference names the path of a secret
+// and one of its fields, separated by #. Once registered for the scheme
+// "vault",
+//
+//	flexconfig.RegisterResolver("vault", r)
+//
+// the reference
+//
+//	${vault://secret/data/db#password}
+//
+// in a property value resolves to the password field of the secret at
+// secret/data/db. The Resolver is only used for references enclosed in
+// ${ and }; a property whose value is vault://secret/data/db#password without
+// them keeps that value. Both KV version 2 secrets and dynamic secrets are
+// supported. Secrets are cached in memory; a secret issued with a lease is
+// renewed when two thirds of its lease has passed, and read again if the
+// lease cannot be renewed or has expired. Properties referring to the
+// Resolver are treated as sensitive.
+func NewVaultResolver(config VaultConfig) (Resolver, error) {
+	if len(config.Address) == 0 {
+		config.Address = os.Getenv(vaultAddressEnvVar)
+	}
+
+	if len(config.Address) == 0 {
+		return nil, ErrVaultAddressRequired
+	}
+
+	config.Address = strings.TrimSuffix(config.Address, "/")
+
+	if len(config.Token) == 0 {
+		config.Token = os.Getenv(vaultTokenEnvVar)
+	}
+
+	if len(config.Namespace) == 0 {
+		config.Namespace = os.Getenv(vaultNamespaceEnvVar)
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{
+			Timeout: time.Duration(vaultRequestTimeoutMs) *
+				time.Millisecond,
+		}
+	}
+
+	vr := new(vaultResolver)
+	vr.config = config
+	vr.client = client
+	vr.now = time.Now
+	vr.secrets = make(map[string]*vaultSecret)
+
+	return vr, nil
+}
+
+// Resolve returns the value of a field of a Vault secret. The reference has
+// the form [//]<path>#<field>.
+func (vr *vaultResolver) Resolve(ref string) (string, error) {
+	ref = strings.TrimPrefix(ref, "//")
+
+	index := strings.LastIndex(ref, vaultFieldSeparator)
+	if index <= 0 || index == len(ref)-1 {
+		return "", ErrVaultFieldRequired
+	}
+
+	path := strings.Trim(ref[:index], "/")
+	field := ref[index+1:]
+
+	secret, err := vr.secret(path)
+	if err != nil {
+		return "", err
+	}
+
+	val, exists := secret.values[field]
+	if !exists {
+		return "", fmt.Errorf("%w: field %s of %s",
+			ErrVaultSecretNotFound, field, path)
+	}
+
+	return val, nil
+}
+
+// Sensitive reports that values read from Vault are sensitive.
+func (vr *vaultResolver) Sensitive() bool {
+	return true
+}
+
+// CachesValues reports that the resolver caches secrets itself, so that
+// secrets with a lease are renewed or read again when the lease expires.
+func (vr *vaultResolver) CachesValues() bool {
+	return true
+}
+
+// secret returns the cached secret at the path, renewing its lease or
+// reading it again as required.
+func (vr *vaultResolver) secret(path string) (*vaultSecret, error) {
+	vr.lock.Lock()
+	defer vr.lock.Unlock()
+
+	now := vr.now()
+	secret := vr.secrets[path]
+	if secret != nil {
+		if secret.expires.IsZero() || now.Before(secret.renewAt) {
+			return secret, nil
+		}
+
+		if secret.renewable && now.Before(secret.expires) {
+			err := vr.renew(secret)
+			if err == nil {
+				return secret, nil
+			}
+		}
+	}
+
+	secret, err := vr.read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	vr.secrets[path] = secret
+
+	return secret, nil
+}
+
+// read requests the secret at the path from Vault.
+func (vr *vaultResolver) read(path string) (*vaultSecret, error) {
+	resp, err := vr.request(http.MethodGet, "/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := resp.Data
+
+	// A KV version 2 secret holds its fields in data.data, alongside
+	// data.metadata.
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = inner
+		}
+	}
+
+	secret := new(vaultSecret)
+	secret.values = make(map[string]string)
+	for k, v := range data {
+		secret.values[k] = vaultValueString(v)
+	}
+
+	secret.leaseID = resp.LeaseID
+	secret.renewable = resp.Renewable && len(resp.LeaseID) > 0
+	vr.setLease(secret, resp.LeaseDuration)
+
+	return secret, nil
+}
+
+// renew extends the lease of a secret.
+func (vr *vaultResolver) renew(secret *vaultSecret) error {
+	body, err := json.Marshal(map[string]string{"lease_id": secret.leaseID})
+	if err != nil {
+		return err
+	}
+
+	resp, err := vr.request(http.MethodPut, "/v1/sys/leases/renew", body)
+	if err != nil {
+		return err
+	}
+
+	if resp.LeaseDuration <= 0 {
+		return fmt.Errorf("Vault lease %s not renewed", secret.leaseID)
+	}
+
+	secret.renewable = resp.Renewable
+	vr.setLease(secret, resp.LeaseDuration)
+
+	return nil
+}
+
+// setLease records when a secret must be renewed and when it expires, given
+// the duration of its lease in seconds. A duration of zero means the secret
+// does not expire.
+func (vr *vaultResolver) setLease(secret *vaultSecret, seconds int64) {
+	if seconds <= 0 {
+		secret.renewAt = time.Time{}
+		secret.expires = time.Time{}
+		return
+	}
+
+	now := vr.now()
+	duration := time.Duration(seconds) * time.Second
+	secret.renewAt = now.Add(duration * 2 / 3)
+	secret.expires = now.Add(duration)
+}
+
+// request sends a request to Vault and decodes the response.
+func (vr *vaultResolver) request(
+	method, path string,
+	body []byte) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, vr.config.Address+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vr.config.Token) > 0 {
+		req.Header.Set(vaultTokenHeader, vr.config.Token)
+	}
+
+	if len(vr.config.Namespace) > 0 {
+		req.Header.Set(vaultNamespaceHeader, vr.config.Namespace)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := vr.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result := new(vaultResponse)
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	decodeErr := decoder.Decode(result)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrVaultSecretNotFound, path)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if decodeErr == nil && len(result.Errors) > 0 {
+			return nil, fmt.Errorf("Vault request for %s failed: %s: %s",
+				path, resp.Status, strings.Join(result.Errors, "; "))
+		}
+
+		return nil, fmt.Errorf("Vault request for %s failed: %s",
+			path, resp.Status)
+	}
+
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return result, nil
+}
+
+// vaultValueString converts a field of a secret to a property value. Values
+// that are not strings are represented as JSON.
+func vaultValueString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	default:
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return ""
+		}
+
+		return string(encoded)
+	}
+}
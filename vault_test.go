@@ -0,0 +1,287 @@
+package flexconfig
+
+/*
+Copyright 2019 The flexconfig Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// vaultStandIn is a minimal server providing the parts of the Vault HTTP API
+// used by the Vault resolver.
+type vaultStandIn struct {
+	lock      sync.Mutex
+	reads     map[string]int
+	renewals  int
+	denyRenew bool
+	namespace string
+}
+
+func (vs *vaultStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	if r.Header.Get(vaultTokenHeader) != "test-token" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": []string{"permission denied"},
+		})
+		return
+	}
+
+	vs.namespace = r.Header.Get(vaultNamespaceHeader)
+	vs.reads[r.URL.Path]++
+
+	switch r.URL.Path {
+	case "/v1/secret/data/db":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_duration": 0,
+			"data": map[string]interface{}{
+				"data": map[string]interface{}{
+					"username": "app",
+					"password": "s3cret",
+					"port":     5432,
+				},
+				"metadata": map[string]interface{}{"version": 3},
+			},
+		})
+	case "/v1/database/creds/app":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_id":       "database/creds/app/abc",
+			"lease_duration": 60,
+			"renewable":      true,
+			"data": map[string]interface{}{
+				"username": "v-app-1",
+				"password": "dynamic",
+			},
+		})
+	case "/v1/sys/leases/renew":
+		if r.Method != http.MethodPut || vs.denyRenew {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		vs.renewals++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_id":       "database/creds/app/abc",
+			"lease_duration": 60,
+			"renewable":      true,
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func newVaultStandIn(t *testing.T) (*vaultStandIn, *httptest.Server) {
+	vs := &vaultStandIn{reads: make(map[string]int)}
+	return vs, httptest.NewServer(vs)
+}
+
+func Test_vault_kv(t *testing.T) {
+	vs, server := newVaultStandIn(t)
+	defer server.Close()
+
+	r, err := NewVaultResolver(VaultConfig{
+		Address:   server.URL,
+		Token:     "test-token",
+		Namespace: "team",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error creating resolver: %v", err)
+		return
+	}
+
+	expected := map[string]string{
+		"//secret/data/db#password": "s3cret",
+		"secret/data/db#username":   "app",
+		"//secret/data/db#port":     "5432",
+	}
+
+	for ref, e := range expected {
+		val, err := r.Resolve(ref)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %v", ref, err)
+			continue
+		}
+
+		if val != e {
+			t.Errorf("Expected %s to be '%s', found '%s'", ref, e, val)
+		}
+	}
+
+	if vs.reads["/v1/secret/data/db"] != 1 {
+		t.Errorf("Expected secret to be read once, read %d times",
+			vs.reads["/v1/secret/data/db"])
+	}
+
+	if vs.namespace != "team" {
+		t.Errorf("Expected namespace 'team', found '%s'", vs.namespace)
+	}
+
+	if !isSensitiveResolver(r) {
+		t.Errorf("Expected Vault resolver to be sensitive")
+	}
+
+	if !cachesValues(r) {
+		t.Errorf("Expected Vault resolver to cache its own values")
+	}
+}
+
+func Test_vault_errors(t *testing.T) {
+	_, server := newVaultStandIn(t)
+	defer server.Close()
+
+	r, err := NewVaultResolver(VaultConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error creating resolver: %v", err)
+		return
+	}
+
+	_, err = r.Resolve("//secret/data/db")
+	if !errors.Is(err, ErrVaultFieldRequired) {
+		t.Errorf("Expected ErrVaultFieldRequired, found %v", err)
+	}
+
+	_, err = r.Resolve("//secret/data/db#nosuchfield")
+	if !errors.Is(err, ErrVaultSecretNotFound) {
+		t.Errorf("Expected ErrVaultSecretNotFound for field, found %v", err)
+	}
+
+	_, err = r.Resolve("//secret/data/missing#password")
+	if !errors.Is(err, ErrVaultSecretNotFound) {
+		t.Errorf("Expected ErrVaultSecretNotFound for path, found %v", err)
+	}
+
+	denied, _ := NewVaultResolver(VaultConfig{
+		Address: server.URL,
+		Token:   "wrong-token",
+	})
+
+	_, err = denied.Resolve("//secret/data/db#password")
+	if err == nil {
+		t.Errorf("Expected error using wrong token")
+	}
+
+	_, err = NewVaultResolver(VaultConfig{})
+	if err != nil && !errors.Is(err, ErrVaultAddressRequired) {
+		t.Errorf("Expected ErrVaultAddressRequired, found %v", err)
+	}
+}
+
+func Test_vault_lease(t *testing.T) {
+	vs, server := newVaultStandIn(t)
+	defer server.Close()
+
+	r, err := NewVaultResolver(VaultConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error creating resolver: %v", err)
+		return
+	}
+
+	now := time.Now()
+	vr := r.(*vaultResolver)
+	vr.now = func() time.Time { return now }
+
+	const ref = "//database/creds/app#password"
+	const path = "/v1/database/creds/app"
+
+	val, err := r.Resolve(ref)
+	if err != nil || val != "dynamic" {
+		t.Errorf("Expected 'dynamic', found '%s' (%v)", val, err)
+	}
+
+	// Within the first two thirds of the lease the cached secret is used
+	now = now.Add(30 * time.Second)
+	r.Resolve(ref)
+	if vs.reads[path] != 1 || vs.renewals != 0 {
+		t.Errorf("Expected cached secret, found %d reads, %d renewals",
+			vs.reads[path], vs.renewals)
+	}
+
+	// Later in the lease, the lease is renewed
+	now = now.Add(15 * time.Second)
+	r.Resolve(ref)
+	if vs.reads[path] != 1 || vs.renewals != 1 {
+		t.Errorf("Expected renewal, found %d reads, %d renewals",
+			vs.reads[path], vs.renewals)
+	}
+
+	// A lease that cannot be renewed causes the secret to be read again
+	vs.denyRenew = true
+	now = now.Add(50 * time.Second)
+	r.Resolve(ref)
+	if vs.reads[path] != 2 {
+		t.Errorf("Expected secret to be read again, found %d reads",
+			vs.reads[path])
+	}
+
+	// An expired lease causes the secret to be read again
+	now = now.Add(2 * time.Minute)
+	r.Resolve(ref)
+	if vs.reads[path] != 3 {
+		t.Errorf("Expected expired secret to be read again, found %d reads",
+			vs.reads[path])
+	}
+}
+
+func Test_vault_interpolate(t *testing.T) {
+	_, server := newVaultStandIn(t)
+	defer server.Close()
+
+	r, err := NewVaultResolver(VaultConfig{
+		Address: server.URL,
+		Token:   "test-token",
+	})
+	if err != nil {
+		t.Errorf("Unexpected error creating resolver: %v", err)
+		return
+	}
+
+	RegisterResolver("testvault", r)
+	defer RegisterResolver("testvault", nil)
+
+	vars := map[string]string{
+		"db.password": "${testvault://secret/data/db#password}",
+		"db.url":      "postgres://app:${db.password}@db",
+	}
+
+	ip := newInterpolator(func(key string) string { return vars[key] })
+	ip.resolvers = lookupResolver
+	ip.cache = newResolverCache()
+
+	val, err := ip.resolveProperty("db.url", vars["db.url"])
+	if err != nil || val != "postgres://app:s3cret@db" {
+		t.Errorf("Expected resolved URL, found '%s' (%v)", val, err)
+	}
+
+	fc := &flexibleConfiguration{config: vars}
+	if !fc.IsSensitive("db.url") {
+		t.Errorf("Expected property referring to Vault to be sensitive")
+	}
+}
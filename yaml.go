@@ -17,7 +17,7 @@ limitations under the License.
 */
 
 import (
-	"reflect"
+	"fmt"
 	"strconv"
 
 	"gopkg.in/yaml.v2"
@@ -39,40 +39,49 @@ func parseYaml(vars map[string]string, contents string) error {
 }
 
 // setYamlStruct accepts a parsed yaml structure (map of interfaces) and
-// creates configuration properties representing the content.
+// creates configuration properties representing the content. Keys that are
+// not strings, such as numbers, are converted to their string form, and
+// null keys are ignored.
 func setYamlStruct(
 	vars map[string]string,
 	prefix string,
 	m map[interface{}]interface{}) {
 	for k, v := range m {
-		key := prefix + k.(string)
-		setYamlVar(vars, key, v)
+		if k == nil {
+			continue
+		}
+
+		name, ok := k.(string)
+		if !ok {
+			name = fmt.Sprint(k)
+		}
+
+		setYamlVar(vars, prefix+name, v)
 	}
 }
 
 // setYamlVar accepts a parsed yaml key and value and creates configuration
 // property (or properties if it is a struct or array) representing the value.
+// A null value creates no property.
 func setYamlVar(vars map[string]string, key string, v interface{}) {
-	switch reflect.TypeOf(v).Name() {
-	case "string":
-		vars[key] = v.(string)
-	case "int":
-		vars[key] = strconv.FormatInt(int64(v.(int)), 10)
-	case "bool":
-		vars[key] = strconv.FormatBool(v.(bool))
-	case "float64":
-		vars[key] = strconv.FormatFloat(v.(float64), 'g', -1, 64)
-	default:
-		if reflect.TypeOf(v).Kind() == reflect.Array ||
-			reflect.TypeOf(v).Kind() == reflect.Slice {
-			a := v.([]interface{})
-			for i, av := range a {
-				setYamlVar(vars, key+"."+strconv.Itoa(i), av)
-			}
-
-			return
+	switch val := v.(type) {
+	case nil:
+		return
+	case string:
+		vars[key] = val
+	case int:
+		vars[key] = strconv.FormatInt(int64(val), 10)
+	case bool:
+		vars[key] = strconv.FormatBool(val)
+	case float64:
+		vars[key] = strconv.FormatFloat(val, 'g', -1, 64)
+	case []interface{}:
+		for i, av := range val {
+			setYamlVar(vars, key+"."+strconv.Itoa(i), av)
 		}
-
-		setYamlStruct(vars, key+".", v.(map[interface{}]interface{}))
+	case map[interface{}]interface{}:
+		setYamlStruct(vars, key+".", val)
+	default:
+		vars[key] = fmt.Sprint(val)
 	}
 }
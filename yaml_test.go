@@ -294,3 +294,33 @@ func Test_notJsonOrYaml(t *testing.T) {
 		t.Errorf("Unexpected success")
 	}
 }
+
+func Test_yaml_nullValue(t *testing.T) {
+	v := make(map[string]string)
+	contents := "a:\nb: ~\nc:\n  - \n  - x\nd: value\n"
+
+	err := parseYaml(v, contents)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if len(v) != 2 || v["d"] != "value" || v["c.1"] != "x" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+}
+
+func Test_yaml_nonStringKey(t *testing.T) {
+	v := make(map[string]string)
+	contents := "1: x\nports:\n  8080: http\ntrue: yes\n~: ignored\n" +
+		"big: 12345678901234567890\n"
+
+	err := parseYaml(v, contents)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if len(v) != 4 || v["1"] != "x" || v["ports.8080"] != "http" ||
+		v["true"] != "true" || v["big"] != "12345678901234567890" {
+		t.Errorf("Unexpected properties: %v", v)
+	}
+}